@@ -1,282 +1,424 @@
 package agent
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"ddgo/internal/collector"
-
-	"github.com/google/uuid"
+	"ddgo/protocol"
 )
 
 // metrics collection agent
 type Agent struct {
-	ID              string
-	Hostname        string
-	ServerURL       string
-	CPUCollector    *collector.CPUCollector
-	MemoryCollector *collector.MemoryCollector
-	DiskCollector   *collector.DiskCollector
-}
+	ID         string
+	Hostname   string
+	ServerURL  string
+	Interval   time.Duration
+	Labels     map[string]string
+	StartedAt  time.Time
+	Host       protocol.HostInfo
+	Collectors []collector.Collector
 
-// system metrics collected by agent
-type AgentMetrics struct {
-	AgentID  string `json:"agent_id"`
-	Hostname string `json:"hostname"`
-	Metrics  struct {
-		CPU struct {
-			Cores []struct {
-				Core  int     `json:"core"`
-				Usage float64 `json:"usage"`
-			} `json:"cores"`
-			Load struct {
-				OneMin     float64 `json:"1m"`
-				FiveMin    float64 `json:"5m"`
-				FifteenMin float64 `json:"15m"`
-			} `json:"load"`
-			Times map[string]struct {
-				User   float64 `json:"user"`
-				System float64 `json:"system"`
-				Idle   float64 `json:"idle"`
-				IOWait float64 `json:"iowait"`
-				IRQ    float64 `json:"irq"`
-			} `json:"times"`
-			Info struct {
-				ProcessCount  int `json:"process_count"`
-				ThreadCount   int `json:"thread_count"`
-				LogicalCores  int `json:"logical_cores"`
-				PhysicalCores int `json:"physical_cores"`
-			} `json:"info"`
-		} `json:"cpu"`
-		Memory struct {
-			Virtual struct {
-				Total     uint64  `json:"total"`
-				Used      uint64  `json:"used"`
-				Free      uint64  `json:"free"`
-				Usage     float64 `json:"usage"`
-				Cached    uint64  `json:"cached"`
-				Available uint64  `json:"available"`
-			} `json:"virtual"`
-			Swap struct {
-				Total uint64  `json:"total"`
-				Used  uint64  `json:"used"`
-				Free  uint64  `json:"free"`
-				Usage float64 `json:"usage"`
-			} `json:"swap"`
-		} `json:"memory"`
-		Disk struct {
-			Usage float64 `json:"usage"`
-			Total uint64  `json:"total"`
-			Free  uint64  `json:"free"`
-			IO    struct {
-				ReadCount  uint64 `json:"read_count"`
-				WriteCount uint64 `json:"write_count"`
-				ReadBytes  uint64 `json:"read_bytes"`
-				WriteBytes uint64 `json:"write_bytes"`
-			} `json:"io"`
-		} `json:"disk"`
-		Time string `json:"time"`
-	} `json:"metrics"`
-	Timestamp time.Time `json:"timestamp"`
+	schedules map[string]schedule // per collector
+	queue     *resultQueue
+	upload    UploadConfig
+	pending   []protocol.MetricsPayload // waiting for their batch to fill
+	sender    *Sender
+	spool     *Spool // nil when spooling is disabled
 }
 
-// create a new agent instance for server
-func NewAgent(serverURL string) (*Agent, error) {
-	hostname, err := os.Hostname()
+// create a new agent instance from its config
+func NewAgent(config Config) (*Agent, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	hostname := config.Hostname
+	if hostname == "" {
+		var err error
+		if hostname, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get hostname: %v", err)
+		}
+	}
+
+	collectors, err := collector.NewSet(config.CollectorNames(), config.Collectors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create collectors: %v", err)
+	}
+
+	tlsConfig, err := config.TLS.build()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get hostname: %v", err)
+		return nil, fmt.Errorf("failed to configure tls: %v", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	var spool *Spool
+	if config.Spool.Dir != "" {
+		if spool, err = OpenSpool(config.Spool); err != nil {
+			fmt.Printf("Warning: payloads will not be buffered during outages: %v\n", err)
+		}
 	}
 
+	schedules := make(map[string]schedule, len(collectors))
+	for _, c := range collectors {
+		options := config.Collectors[c.Name()]
+		schedules[c.Name()] = schedule{
+			interval: options.Duration("interval", config.Interval),
+			timeout:  options.Duration("timeout", config.CollectorTimeout),
+		}
+	}
+
+	serverURL := strings.TrimSuffix(config.Server, "/")
+
 	return &Agent{
-		ID:              uuid.New().String(),
-		Hostname:        hostname,
-		ServerURL:       serverURL,
-		CPUCollector:    collector.CreateCPUCollector(0),
-		MemoryCollector: collector.CreateMemoryCollector(),
-		DiskCollector:   collector.CreateDiskCollector(),
+		ID:         resolveAgentID(config),
+		Hostname:   hostname,
+		ServerURL:  serverURL,
+		Interval:   config.Interval,
+		Labels:     config.Labels,
+		StartedAt:  time.Now(),
+		Host:       discoverHost(),
+		Collectors: collectors,
+		schedules:  schedules,
+		queue:      newResultQueue(config.Queue),
+		upload:     config.Upload,
+		spool:      spool,
+		sender:     CreateSender(serverURL+"/api/v2/metrics/collect", transport, config.Sender, config.Upload.Compression),
 	}, nil
 }
 
-// collect all metrics and send to server
-func (a *Agent) CollectAndSend() error {
-	metrics := AgentMetrics{
-		AgentID:   a.ID,
-		Hostname:  a.Hostname,
-		Timestamp: time.Now(),
-	}
+// how often a collector runs and how long a run may take
+type schedule struct {
+	interval time.Duration
+	timeout  time.Duration
+}
 
-	cpuMetrics, err := a.CPUCollector.Collect()
-	if err != nil {
-		return fmt.Errorf("CPU collection error: %v", err)
-	}
+// outcome of a single Collect call
+type collectOutcome struct {
+	metrics []collector.Metric
+	err     error
+}
+
+// run a collector on its own schedule, starting right away. failures and
+// timeouts are queued as errors so the sender reports them in place of the
+// collector's metrics
+func (a *Agent) runCollector(c collector.Collector, sched schedule) {
+	ticker := time.NewTicker(sched.interval)
+	defer ticker.Stop()
+
+	// a run that timed out keeps going in the background, later ticks wait
+	// for it instead of starting another
+	var running chan collectOutcome
+	var started time.Time
+
+	for {
+		if running == nil {
+			running, started = make(chan collectOutcome, 1), time.Now()
+			go collectSafely(c, running)
+		}
+
+		result := collectorResult{collector: c.Name()}
 
-	// parse cpu metrics
-	for _, metric := range cpuMetrics {
-		switch metric.Name {
-		case "cpu_usage":
-			if core, ok := metric.Labels["cpu"]; ok {
-				var coreNum int
-				fmt.Sscanf(core, "cpu%d", &coreNum)
-				metrics.Metrics.CPU.Cores = append(metrics.Metrics.CPU.Cores, struct {
-					Core  int     `json:"core"`
-					Usage float64 `json:"usage"`
-				}{
-					Core:  coreNum,
-					Usage: metric.Value,
-				})
+		timeout := time.NewTimer(sched.timeout)
+		select {
+		case outcome := <-running:
+			running = nil
+			if outcome.err != nil {
+				result.err = collectorError(c.Name(), outcome.err.Error(), started)
+			} else {
+				collector.Annotate(outcome.metrics)
+				result.metrics = outcome.metrics
 			}
-		case "cpu_load_average_1m":
-			metrics.Metrics.CPU.Load.OneMin = metric.Value
-		case "cpu_load_average_5m":
-			metrics.Metrics.CPU.Load.FiveMin = metric.Value
-		case "cpu_load_average_15m":
-			metrics.Metrics.CPU.Load.FifteenMin = metric.Value
-		case "system_processes_total":
-			metrics.Metrics.CPU.Info.ProcessCount = int(metric.Value)
-		case "system_threads_total":
-			metrics.Metrics.CPU.Info.ThreadCount = int(metric.Value)
-		case "cpu_cores_logical":
-			metrics.Metrics.CPU.Info.LogicalCores = int(metric.Value)
-		case "cpu_cores_physical":
-			metrics.Metrics.CPU.Info.PhysicalCores = int(metric.Value)
+		case <-timeout.C:
+			message := fmt.Sprintf("timed out, still running after %s", time.Since(started).Round(time.Millisecond))
+			result.err = collectorError(c.Name(), message, started)
+		}
+		timeout.Stop()
+
+		if result.err != nil {
+			log.Printf("%s collection error: %s", c.Name(), result.err.Message)
+		}
+		a.queue.push(result)
+
+		<-ticker.C
+	}
+}
+
+// run Collect, turning a panic into an error
+func collectSafely(c collector.Collector, done chan<- collectOutcome) {
+	defer func() {
+		if r := recover(); r != nil {
+			done <- collectOutcome{err: fmt.Errorf("panic: %v", r)}
 		}
+	}()
+
+	metrics, err := c.Collect()
+	done <- collectOutcome{metrics: metrics, err: err}
+}
+
+func collectorError(name, message string, started time.Time) *protocol.CollectorError {
+	return &protocol.CollectorError{
+		Collector: name,
+		Message:   message,
+		Duration:  time.Since(started).Seconds(),
+		Timestamp: time.Now(),
+	}
+}
+
+// drain collector results and, each interval, hand a payload holding the
+// results received since the previous one to the delivery goroutine. a
+// collector that reports more than once per interval only has its latest
+// result sent, the earlier ones count as superseded. collectors running
+// less often than interval have their last metrics repeated, marked stale,
+// so every payload is a full snapshot
+func (a *Agent) sendLoop() {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+
+	latest := make(map[string]collectorResult) // per collector
+	fresh := make(map[string]bool)             // reported since the previous payload
+	var lastDropped uint64
 
-		// cpu times
-		if metric.Labels["cpu"] != "" {
-			cpu := metric.Labels["cpu"]
-			if metrics.Metrics.CPU.Times == nil {
-				metrics.Metrics.CPU.Times = make(map[string]struct {
-					User   float64 `json:"user"`
-					System float64 `json:"system"`
-					Idle   float64 `json:"idle"`
-					IOWait float64 `json:"iowait"`
-					IRQ    float64 `json:"irq"`
-				})
+	for {
+		select {
+		case result := <-a.queue.ch:
+			if fresh[result.collector] {
+				a.queue.superseded.Add(1)
 			}
-			times := metrics.Metrics.CPU.Times[cpu]
-			switch metric.Name {
-			case "cpu_time_user":
-				times.User = metric.Value
-			case "cpu_time_system":
-				times.System = metric.Value
-			case "cpu_time_idle":
-				times.Idle = metric.Value
-			case "cpu_time_iowait":
-				times.IOWait = metric.Value
-			case "cpu_time_irq":
-				times.IRQ = metric.Value
+			latest[result.collector] = result
+			fresh[result.collector] = true
+		case <-ticker.C:
+			if dropped := a.queue.dropped.Load(); dropped > lastDropped {
+				fmt.Printf("Warning: sender falling behind, dropped %d collector results\n", dropped-lastDropped)
+				lastDropped = dropped
+			}
+
+			if len(fresh) == 0 {
+				continue
 			}
-			metrics.Metrics.CPU.Times[cpu] = times
+			a.enqueue(outgoing{payload: a.buildPayload(latest, fresh), results: len(fresh)})
+			fresh = make(map[string]bool)
 		}
 	}
+}
 
-	// memory metrics
-	memMetrics, err := a.MemoryCollector.Collect()
-	if err != nil {
-		return fmt.Errorf("Memory collection error: %v", err)
+// hand a payload to the delivery goroutine. when too many are waiting,
+// block holds up the sender, and so the collectors once their results fill
+// the queue, while drop_oldest evicts the oldest waiting payload
+func (a *Agent) enqueue(out outgoing) {
+	select {
+	case a.queue.payloads <- out:
+		return
+	default:
 	}
 
-	// parse memory metrics
-	for _, metric := range memMetrics {
-		if metric.Labels["type"] == "virtual" {
-			switch metric.Name {
-			case "memory_usage":
-				metrics.Metrics.Memory.Virtual.Usage = metric.Value
-			case "memory_total":
-				metrics.Metrics.Memory.Virtual.Total = uint64(metric.Value)
-			case "memory_used":
-				metrics.Metrics.Memory.Virtual.Used = uint64(metric.Value)
-			case "memory_free":
-				metrics.Metrics.Memory.Virtual.Free = uint64(metric.Value)
-			case "memory_cached":
-				metrics.Metrics.Memory.Virtual.Cached = uint64(metric.Value)
-			case "memory_available":
-				metrics.Metrics.Memory.Virtual.Available = uint64(metric.Value)
-			}
-		} else if metric.Labels["type"] == "swap" {
-			switch metric.Name {
-			case "memory_usage":
-				metrics.Metrics.Memory.Swap.Usage = metric.Value
-			case "memory_total":
-				metrics.Metrics.Memory.Swap.Total = uint64(metric.Value)
-			case "memory_used":
-				metrics.Metrics.Memory.Swap.Used = uint64(metric.Value)
-			case "memory_free":
-				metrics.Metrics.Memory.Swap.Free = uint64(metric.Value)
+	if a.queue.policy == PolicyBlock {
+		a.queue.blocked.Add(1)
+		a.queue.payloads <- out
+		return
+	}
+
+	for {
+		select {
+		case old := <-a.queue.payloads:
+			a.evict(old)
+		default:
+		}
+
+		select {
+		case a.queue.payloads <- out:
+			return
+		default:
+		}
+	}
+}
+
+// spool a payload evicted from the queue so it is replayed later, or drop
+// it when there is no spool
+func (a *Agent) evict(out outgoing) {
+	if a.spool != nil {
+		data, err := json.Marshal(out.payload)
+		if err == nil {
+			err = a.spool.Push(data)
+		}
+		if err == nil {
+			return
+		}
+		fmt.Printf("Warning: failed to buffer payload: %v\n", err)
+	}
+
+	a.queue.dropped.Add(uint64(out.results))
+}
+
+// send payloads in order. retries and spool replay only hold up this
+// goroutine, collector results keep being drained meanwhile. a partial
+// batch is flushed once its oldest payload has waited flush_interval, even
+// when no further payloads arrive
+func (a *Agent) deliveryLoop() {
+	for {
+		var timer *time.Timer
+		var due <-chan time.Time
+		if len(a.pending) > 0 {
+			timer = time.NewTimer(time.Until(a.pending[0].Timestamp.Add(a.upload.FlushInterval)))
+			due = timer.C
+		}
+
+		var err error
+		select {
+		case out := <-a.queue.payloads:
+			err = a.send(out.payload)
+		case <-due:
+			err = a.flush()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if err != nil {
+			log.Printf("Error sending metrics: %v", err)
+		}
+	}
+}
+
+// build a payload from the latest result of each collector, those not in
+// fresh are repeated from an earlier payload. a failure is only reported
+// once, collectors whose last run failed are left out until they succeed
+func (a *Agent) buildPayload(latest map[string]collectorResult, fresh map[string]bool) protocol.MetricsPayload {
+	payload := protocol.NewMetricsPayload(a.ID, a.Hostname, time.Now())
+	payload.Labels = a.Labels
+	payload.StartedAt = a.StartedAt
+
+	host := a.Host
+	host.IPs = hostIPs()
+	payload.Host = &host
+
+	// in collector order, so payloads are stable
+	for _, c := range a.Collectors {
+		result, ok := latest[c.Name()]
+		if !ok {
+			continue
+		}
+		if !fresh[c.Name()] {
+			if result.err != nil {
+				continue
 			}
+			payload.Stale = append(payload.Stale, c.Name())
+		}
+		if result.err != nil {
+			payload.Errors = append(payload.Errors, *result.err)
+			continue
 		}
+		payload.Metrics = append(payload.Metrics, result.metrics...)
 	}
 
-	// disk metrics
-	diskMetrics, err := a.DiskCollector.Collect()
-	if err != nil {
-		return fmt.Errorf("Disk collection error: %v", err)
+	payload.Metrics = append(payload.Metrics, a.queue.metrics(payload.Timestamp)...)
+	if a.spool != nil {
+		payload.Metrics = append(payload.Metrics, a.spool.Stats().metrics(payload.Timestamp)...)
 	}
 
-	// format disk metrics
-	for _, metric := range diskMetrics {
-		switch metric.Name {
-		case "disk_usage":
-			metrics.Metrics.Disk.Usage = metric.Value
-		case "disk_total":
-			metrics.Metrics.Disk.Total = uint64(metric.Value)
-		case "disk_free":
-			metrics.Metrics.Disk.Free = uint64(metric.Value)
-		case "disk_reads_total":
-			metrics.Metrics.Disk.IO.ReadCount = uint64(metric.Value)
-		case "disk_writes_total":
-			metrics.Metrics.Disk.IO.WriteCount = uint64(metric.Value)
-		case "disk_read_bytes_total":
-			metrics.Metrics.Disk.IO.ReadBytes = uint64(metric.Value)
-		case "disk_write_bytes_total":
-			metrics.Metrics.Disk.IO.WriteBytes = uint64(metric.Value)
+	return payload
+}
+
+// send a payload to the server, or add it to the pending batch
+func (a *Agent) send(payload protocol.MetricsPayload) error {
+	if !a.upload.batching() {
+		// marshal and send to server
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal metrics: %v", err)
 		}
+
+		return a.deliver(data)
+	}
+
+	a.pending = append(a.pending, payload)
+	if len(a.pending) < a.upload.MaxBatchSize && time.Since(a.pending[0].Timestamp) < a.upload.FlushInterval {
+		return nil
 	}
 
-	metrics.Metrics.Time = time.Now().Format(time.RFC3339)
+	return a.flush()
+}
+
+// send the pending payloads as one batch request. a batch that cannot be
+// marshalled never will be, so it is dropped rather than kept growing
+func (a *Agent) flush() error {
+	batch := a.pending
+	a.pending = nil
 
-	// marshal and send to server
-	data, err := json.Marshal(metrics)
+	data, err := json.Marshal(batch)
 	if err != nil {
-		return fmt.Errorf("failed to marshal metrics: %v", err)
+		return fmt.Errorf("failed to marshal metrics, dropped %d payloads: %v", len(batch), err)
 	}
 
-	resp, err := http.Post(
-		fmt.Sprintf("%s/api/metrics/collect", a.ServerURL),
-		"application/json",
-		bytes.NewBuffer(data),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to send metrics: %v", err)
+	return a.deliver(data)
+}
+
+// send a payload, replaying any backlog first so the server receives
+// payloads in order. payloads that cannot be delivered are spooled
+func (a *Agent) deliver(data []byte) error {
+	if a.spool == nil {
+		return a.sender.Send(data)
+	}
+
+	if a.spool.Len() > 0 {
+		replayed, err := a.spool.Replay(a.sender.Send)
+		if replayed > 0 {
+			stats := a.spool.Stats()
+			log.Printf("Replayed %d buffered payloads (buffered %d, replayed %d, dropped %d since start)",
+				replayed, stats.Buffered, stats.Replayed, stats.Dropped)
+		}
+		if err != nil {
+			return a.buffer(data, err)
+		}
+
+		// the rest of the backlog goes out with the next payloads, queue
+		// this one behind it to keep the order
+		if a.spool.Len() > 0 {
+			if err := a.spool.Push(data); err != nil {
+				return fmt.Errorf("failed to buffer payload: %v", err)
+			}
+			return nil
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned status: %s", resp.Status)
+	if err := a.sender.Send(data); err != nil {
+		if !retryable(err) {
+			return err
+		}
+		return a.buffer(data, err)
 	}
 
 	return nil
 }
 
-// start the agent and send metrics to server
-func (a *Agent) Start() error {
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
+func (a *Agent) buffer(data []byte, sendErr error) error {
+	if err := a.spool.Push(data); err != nil {
+		return fmt.Errorf("%v; failed to buffer payload: %v", sendErr, err)
+	}
 
+	stats := a.spool.Stats()
+	return fmt.Errorf("%v; buffered payload (%d pending, %d bytes, %d dropped)",
+		sendErr, stats.Pending, stats.PendingBytes, stats.Dropped)
+}
+
+// start the collectors and send their metrics to the server
+func (a *Agent) Start() error {
 	log.Printf("Agent started. ID: %s, Hostname: %s", a.ID, a.Hostname)
-	log.Printf("Sending metrics to: %s", a.ServerURL)
+	log.Printf("Sending metrics to: %s every %s", a.ServerURL, a.Interval)
 
-	for {
-		select {
-		case <-ticker.C:
-			if err := a.CollectAndSend(); err != nil {
-				log.Printf("Error collecting/sending metrics: %v", err)
-			}
-		}
+	for _, c := range a.Collectors {
+		go a.runCollector(c, a.schedules[c.Name()])
 	}
+
+	go a.deliveryLoop()
+	a.sendLoop()
+
+	return nil
 }
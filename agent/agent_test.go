@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ddgo/internal/collector"
+	"ddgo/protocol"
+)
+
+// an agent with only its delivery side set up, sending to url
+func testDeliveryAgent(url string, upload UploadConfig) *Agent {
+	return &Agent{
+		ID:     "test",
+		queue:  newResultQueue(DefaultQueueConfig()),
+		upload: upload,
+		sender: CreateSender(url, nil, testSenderConfig(), ""),
+	}
+}
+
+func TestDeliveryFlushesPartialBatch(t *testing.T) {
+	batches := make(chan []protocol.MetricsPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []protocol.MetricsPayload
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &batch); err != nil {
+			t.Errorf("unmarshal batch: %v", err)
+		}
+		batches <- batch
+	}))
+	defer server.Close()
+
+	upload := UploadConfig{MaxBatchSize: 5, FlushInterval: 100 * time.Millisecond}
+	a := testDeliveryAgent(server.URL, upload)
+	go a.deliveryLoop()
+
+	// two payloads and then nothing, as when every collector is slow
+	started := time.Now()
+	for i := 0; i < 2; i++ {
+		a.queue.payloads <- outgoing{payload: protocol.NewMetricsPayload(a.ID, "host", time.Now()), results: 1}
+	}
+
+	select {
+	case batch := <-batches:
+		if len(batch) != 2 {
+			t.Errorf("flushed %d payloads, want 2", len(batch))
+		}
+		if elapsed := time.Since(started); elapsed < upload.FlushInterval {
+			t.Errorf("flushed after %s, before flush_interval", elapsed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("partial batch not flushed after flush_interval")
+	}
+}
+
+func TestFlushDropsUnmarshallableBatch(t *testing.T) {
+	a := testDeliveryAgent("http://localhost", UploadConfig{MaxBatchSize: 5, FlushInterval: time.Minute})
+
+	payload := protocol.NewMetricsPayload(a.ID, "host", time.Now())
+	payload.Metrics = append(payload.Metrics, protocol.Metric{Name: "broken", Value: math.NaN()})
+	a.pending = append(a.pending, payload)
+
+	if err := a.flush(); err == nil {
+		t.Fatal("flush of a NaN metric succeeded, want a marshal error")
+	}
+	if len(a.pending) != 0 {
+		t.Errorf("%d payloads still pending after a marshal error, want 0", len(a.pending))
+	}
+}
+
+type namedCollector string
+
+func (c namedCollector) Name() string                         { return string(c) }
+func (c namedCollector) Collect() ([]collector.Metric, error) { return nil, nil }
+
+func TestBuildPayloadRepeatsStaleResults(t *testing.T) {
+	a := &Agent{
+		Collectors: []collector.Collector{namedCollector("cpu"), namedCollector("disk"), namedCollector("sensors")},
+		queue:      newResultQueue(DefaultQueueConfig()),
+	}
+
+	latest := map[string]collectorResult{
+		"cpu":     {collector: "cpu", metrics: []collector.Metric{{Name: "cpu_usage_percent"}}},
+		"disk":    {collector: "disk", metrics: []collector.Metric{{Name: "disk_used_bytes"}}},
+		"sensors": {collector: "sensors", err: &protocol.CollectorError{Collector: "sensors"}},
+	}
+
+	// disk ran in an earlier interval, the sensors failure was already sent
+	payload := a.buildPayload(latest, map[string]bool{"cpu": true})
+
+	names := make(map[string]bool)
+	for _, m := range payload.Metrics {
+		names[m.Name] = true
+	}
+	if !names["cpu_usage_percent"] || !names["disk_used_bytes"] {
+		t.Errorf("payload metrics %v, want cpu and the repeated disk metrics", names)
+	}
+	if len(payload.Stale) != 1 || payload.Stale[0] != "disk" {
+		t.Errorf("stale = %v, want [disk]", payload.Stale)
+	}
+	if len(payload.Errors) != 0 {
+		t.Errorf("errors = %v, want the sensors failure reported only once", payload.Errors)
+	}
+
+	payload = a.buildPayload(latest, map[string]bool{"sensors": true})
+	if len(payload.Errors) != 1 || len(payload.Stale) != 2 {
+		t.Errorf("errors = %v, stale = %v, want the sensors failure and cpu, disk stale", payload.Errors, payload.Stale)
+	}
+}
+
+func TestEnqueueDropOldest(t *testing.T) {
+	config := DefaultQueueConfig()
+	config.Payloads = 2
+
+	a := &Agent{ID: "test", queue: newResultQueue(config)}
+	for i := 0; i < 4; i++ {
+		payload := protocol.NewMetricsPayload(a.ID, "host", time.Unix(int64(i), 0))
+		a.enqueue(outgoing{payload: payload, results: 3})
+	}
+
+	if dropped := a.queue.dropped.Load(); dropped != 6 {
+		t.Errorf("dropped %d results, want the 6 of the two evicted payloads", dropped)
+	}
+	if oldest := (<-a.queue.payloads).payload.Timestamp; oldest != time.Unix(2, 0) {
+		t.Errorf("oldest waiting payload from %s, want the third", oldest)
+	}
+}
+
+func TestEnqueueSpoolsEvicted(t *testing.T) {
+	config := DefaultQueueConfig()
+	config.Payloads = 1
+
+	a := &Agent{ID: "test", queue: newResultQueue(config)}
+	a.spool = openTestSpool(t, testSpoolConfig(t.TempDir()))
+
+	for i := 0; i < 3; i++ {
+		a.enqueue(outgoing{payload: protocol.NewMetricsPayload(a.ID, "host", time.Now()), results: 1})
+	}
+
+	if dropped := a.queue.dropped.Load(); dropped != 0 {
+		t.Errorf("dropped %d results with a spool, want 0", dropped)
+	}
+	if n := a.spool.Len(); n != 2 {
+		t.Errorf("spooled %d evicted payloads, want 2", n)
+	}
+}
+
+func TestEnqueueBlock(t *testing.T) {
+	config := DefaultQueueConfig()
+	config.Payloads = 1
+	config.Policy = PolicyBlock
+
+	a := &Agent{ID: "test", queue: newResultQueue(config)}
+	a.enqueue(outgoing{results: 1})
+
+	done := make(chan struct{})
+	go func() {
+		a.enqueue(outgoing{results: 1})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("enqueue into a full queue returned under block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-a.queue.payloads
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue still blocked after delivery caught up")
+	}
+
+	if blocked := a.queue.blocked.Load(); blocked != 1 {
+		t.Errorf("blocked = %d, want 1", blocked)
+	}
+	if dropped := a.queue.dropped.Load(); dropped != 0 {
+		t.Errorf("dropped = %d under block, want 0", dropped)
+	}
+}
@@ -0,0 +1,367 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ddgo/internal/collector"
+
+	"gopkg.in/yaml.v3"
+)
+
+// agent settings, read from a yaml file and overridden by DDGO_* environment
+// variables
+type Config struct {
+	Server   string        `yaml:"server"`
+	Interval time.Duration `yaml:"interval"`
+	Hostname string        `yaml:"hostname"` // defaults to os.Hostname
+
+	// fixed agent id, otherwise kept in StateFile across restarts
+	ID        string `yaml:"id"`
+	StateFile string `yaml:"state_file"`
+
+	// options of the collectors to run. listed collectors run on top of the
+	// default set unless they have "enabled: false", and "interval" and
+	// "timeout" override Interval and CollectorTimeout
+	Collectors       map[string]collector.Options `yaml:"collectors"`
+	CollectorTimeout time.Duration                `yaml:"collector_timeout"`
+
+	// attached to every payload
+	Labels map[string]string `yaml:"labels"`
+
+	TLS TLSConfig `yaml:"tls"`
+
+	Queue  QueueConfig  `yaml:"queue"`
+	Upload UploadConfig `yaml:"upload"`
+	Sender SenderConfig `yaml:"sender"`
+	Spool  SpoolConfig  `yaml:"spool"`
+}
+
+// client side tls settings for https servers
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Server:           "http://localhost:8080",
+		Interval:         2 * time.Second,
+		CollectorTimeout: 10 * time.Second,
+		StateFile:        "/var/lib/ddgo/agent-id",
+		Queue:            DefaultQueueConfig(),
+		Upload:           DefaultUploadConfig(),
+		Sender:           DefaultSenderConfig(),
+		Spool:            DefaultSpoolConfig(),
+	}
+}
+
+// read the config file at path, if any, and apply environment overrides
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config, fmt.Errorf("error reading config: %v", err)
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+			return config, fmt.Errorf("error parsing config %s: %v", path, err)
+		}
+	}
+
+	if err := config.applyEnv(); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// DDGO_SERVER, DDGO_INTERVAL, DDGO_HOSTNAME, DDGO_AGENT_ID, DDGO_STATE_FILE,
+// DDGO_SPOOL_DIR, DDGO_COLLECTORS (comma-separated), DDGO_LABELS
+// (comma-separated key=value pairs) and DDGO_TLS_*
+func (c *Config) applyEnv() error {
+	if value, ok := os.LookupEnv("DDGO_SERVER"); ok {
+		c.Server = value
+	}
+
+	if value, ok := os.LookupEnv("DDGO_INTERVAL"); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid DDGO_INTERVAL %q: %v", value, err)
+		}
+		c.Interval = interval
+	}
+
+	if value, ok := os.LookupEnv("DDGO_HOSTNAME"); ok {
+		c.Hostname = value
+	}
+
+	if value, ok := os.LookupEnv("DDGO_AGENT_ID"); ok {
+		c.ID = value
+	}
+
+	if value, ok := os.LookupEnv("DDGO_STATE_FILE"); ok {
+		c.StateFile = value
+	}
+
+	if value, ok := os.LookupEnv("DDGO_SPOOL_DIR"); ok {
+		c.Spool.Dir = value
+	}
+
+	if value, ok := os.LookupEnv("DDGO_COLLECTORS"); ok {
+		c.SetCollectors(splitList(value))
+	}
+
+	if value, ok := os.LookupEnv("DDGO_LABELS"); ok {
+		if c.Labels == nil {
+			c.Labels = make(map[string]string)
+		}
+		for _, pair := range splitList(value) {
+			key, label, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("invalid DDGO_LABELS entry %q, expected key=value", pair)
+			}
+			c.Labels[strings.TrimSpace(key)] = strings.TrimSpace(label)
+		}
+	}
+
+	if value, ok := os.LookupEnv("DDGO_TLS_CA_FILE"); ok {
+		c.TLS.CAFile = value
+	}
+	if value, ok := os.LookupEnv("DDGO_TLS_CERT_FILE"); ok {
+		c.TLS.CertFile = value
+	}
+	if value, ok := os.LookupEnv("DDGO_TLS_KEY_FILE"); ok {
+		c.TLS.KeyFile = value
+	}
+	if value, ok := os.LookupEnv("DDGO_TLS_SERVER_NAME"); ok {
+		c.TLS.ServerName = value
+	}
+	if value, ok := os.LookupEnv("DDGO_TLS_INSECURE_SKIP_VERIFY"); ok {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid DDGO_TLS_INSECURE_SKIP_VERIFY %q: %v", value, err)
+		}
+		c.TLS.InsecureSkipVerify = insecure
+	}
+
+	return nil
+}
+
+// collector options handled by the agent rather than the collector
+var scheduleOptions = []string{"enabled", "interval", "timeout"}
+
+// run exactly the named collectors, keeping any options already configured
+// for them. an empty list runs the default set
+func (c *Config) SetCollectors(names []string) {
+	collectors := make(map[string]collector.Options, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		options := c.Collectors[name]
+		if options != nil {
+			delete(options, "enabled")
+		}
+		collectors[name] = options
+	}
+
+	// defaults that are not listed would still run otherwise
+	if len(collectors) > 0 {
+		for _, name := range collector.Names() {
+			if _, listed := collectors[name]; !listed {
+				collectors[name] = collector.Options{"enabled": false}
+			}
+		}
+	}
+
+	c.Collectors = collectors
+}
+
+// the default collectors plus any others listed, minus those listed with
+// "enabled: false", sorted by name
+func (c Config) CollectorNames() []string {
+	enabled := make(map[string]bool)
+	for _, name := range collector.DefaultNames() {
+		enabled[name] = true
+	}
+	for name, options := range c.Collectors {
+		enabled[name] = options.Bool("enabled", true)
+	}
+
+	names := []string{}
+	for name, on := range enabled {
+		if on {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// report every problem with the config, not just the first
+func (c Config) Validate() error {
+	problems := []string{}
+
+	serverURL, err := url.Parse(c.Server)
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("server: %v", err))
+	case serverURL.Scheme != "http" && serverURL.Scheme != "https":
+		problems = append(problems, fmt.Sprintf("server: unsupported scheme %q, expected http or https", serverURL.Scheme))
+	case serverURL.Host == "":
+		problems = append(problems, fmt.Sprintf("server: missing host in %q", c.Server))
+	}
+
+	if c.Interval <= 0 {
+		problems = append(problems, fmt.Sprintf("interval: must be positive, got %s", c.Interval))
+	}
+
+	if c.CollectorTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("collector_timeout: must be positive, got %s", c.CollectorTimeout))
+	}
+
+	known := make(map[string]bool)
+	for _, name := range collector.Names() {
+		known[name] = true
+	}
+	for name, options := range c.Collectors {
+		if !known[name] {
+			problems = append(problems, fmt.Sprintf("collectors: unknown collector %q (available: %s)",
+				name, strings.Join(collector.Names(), ", ")))
+		} else if collectorOptions, err := collector.KnownOptions(name); err == nil {
+			available := append(append([]string{}, scheduleOptions...), collectorOptions...)
+			for key := range options {
+				if !contains(available, key) {
+					problems = append(problems, fmt.Sprintf("collectors.%s: unknown option %q (available: %s)",
+						name, key, strings.Join(available, ", ")))
+				}
+			}
+		}
+		for _, key := range []string{"interval", "timeout"} {
+			if _, set := options[key]; set && options.Duration(key, 0) <= 0 {
+				problems = append(problems, fmt.Sprintf("collectors.%s.%s: must be a positive duration, got %v",
+					name, key, options[key]))
+			}
+		}
+	}
+	enabled := c.CollectorNames()
+	if len(enabled) == 0 {
+		problems = append(problems, "collectors: every collector is disabled")
+	}
+
+	// options only the collector itself can check
+	for _, name := range enabled {
+		if !known[name] {
+			continue
+		}
+		if _, err := collector.New(name, c.Collectors[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("collectors.%s: %v", name, err))
+		}
+	}
+
+	for key := range c.Labels {
+		if key == "" {
+			problems = append(problems, "labels: empty label name")
+		}
+	}
+
+	problems = append(problems, c.Queue.validate()...)
+	problems = append(problems, c.Upload.validate()...)
+	problems = append(problems, c.Sender.validate()...)
+	problems = append(problems, c.Spool.validate()...)
+
+	if _, err := c.TLS.build(); err != nil {
+		problems = append(problems, fmt.Sprintf("tls: %v", err))
+	} else if c.TLS.enabled() && serverURL != nil && serverURL.Scheme != "https" {
+		problems = append(problems, "tls: settings require an https server")
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+func (t TLSConfig) enabled() bool {
+	return t != TLSConfig{}
+}
+
+// tls.Config for the http client, nil when no tls settings are given
+func (t TLSConfig) build() (*tls.Config, error) {
+	if !t.enabled() {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ca_file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_file %s", t.CAFile)
+		}
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, fmt.Errorf("cert_file and key_file must be set together")
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// comma-separated values, ignoring empty entries
+func splitList(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
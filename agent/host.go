@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"sort"
+
+	"ddgo/protocol"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// host facts that do not change while the agent runs, ips are filled in by
+// hostIPs on every payload
+func discoverHost() protocol.HostInfo {
+	info := protocol.HostInfo{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+	}
+
+	hostInfo, err := host.Info()
+	if err != nil {
+		fmt.Printf("Warning: could not discover host facts: %v\n", err)
+		return info
+	}
+
+	info.Platform = hostInfo.Platform
+	info.PlatformVersion = hostInfo.PlatformVersion
+	info.Kernel = hostInfo.KernelVersion
+	if hostInfo.KernelArch != "" {
+		info.Arch = hostInfo.KernelArch
+	}
+	info.Virtualization = hostInfo.VirtualizationSystem
+	info.VirtualizationRole = hostInfo.VirtualizationRole
+
+	return info
+}
+
+// global unicast addresses of all interfaces, sorted
+func hostIPs() []string {
+	ips := []string{}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ips
+	}
+
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		ips = append(ips, ipNet.IP.String())
+	}
+	sort.Strings(ips)
+
+	return ips
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// namespace for ids derived from /etc/machine-id, so the raw machine id
+// never leaves the host
+var machineIDNamespace = uuid.MustParse("6f1c6b52-3c57-4f0e-9a43-1c8d2f0b7e15")
+
+var machineIDPaths = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// stable agent id: the configured override, then the state file, then one
+// derived from the machine id, then a random one. the result is written
+// back to the state file so it survives restarts
+func resolveAgentID(config Config) string {
+	if config.ID != "" {
+		return config.ID
+	}
+
+	if config.StateFile != "" {
+		if data, err := os.ReadFile(config.StateFile); err == nil {
+			if id := strings.TrimSpace(string(data)); id != "" {
+				return id
+			}
+		}
+	}
+
+	id := machineAgentID()
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	if config.StateFile != "" {
+		if err := writeStateFile(config.StateFile, id); err != nil {
+			fmt.Printf("Warning: agent id will not persist across restarts: %v\n", err)
+		}
+	}
+
+	return id
+}
+
+func machineAgentID() string {
+	for _, path := range machineIDPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if machineID := strings.TrimSpace(string(data)); machineID != "" {
+			return uuid.NewSHA1(machineIDNamespace, []byte(machineID)).String()
+		}
+	}
+
+	return ""
+}
+
+// write through a temporary file so a crash never leaves a partial id
+func writeStateFile(path, id string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating state directory: %v", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(id+"\n"), 0644); err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"ddgo/internal/collector"
+	"ddgo/protocol"
+)
+
+// what happens when the queues to the server are full
+const (
+	PolicyDropOldest = "drop_oldest" // discard the oldest queued result or payload
+	PolicyBlock      = "block"       // wait until delivery catches up
+)
+
+// the queues between collectors, the sender and delivery to the server
+type QueueConfig struct {
+	Size     int    `yaml:"size"`     // collector results
+	Payloads int    `yaml:"payloads"` // payloads waiting for delivery
+	Policy   string `yaml:"policy"`
+}
+
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Size:     100,
+		Payloads: 10,
+		Policy:   PolicyDropOldest,
+	}
+}
+
+func (c QueueConfig) validate() []string {
+	problems := []string{}
+
+	if c.Size < 1 {
+		problems = append(problems, fmt.Sprintf("queue.size: must be at least 1, got %d", c.Size))
+	}
+	if c.Payloads < 1 {
+		problems = append(problems, fmt.Sprintf("queue.payloads: must be at least 1, got %d", c.Payloads))
+	}
+
+	switch c.Policy {
+	case PolicyDropOldest, PolicyBlock:
+	default:
+		problems = append(problems, fmt.Sprintf("queue.policy: unknown policy %q, expected %s or %s",
+			c.Policy, PolicyDropOldest, PolicyBlock))
+	}
+
+	return problems
+}
+
+// the metrics of one collector run, or why there are none
+type collectorResult struct {
+	collector string
+	metrics   []collector.Metric
+	err       *protocol.CollectorError
+}
+
+// a payload on its way to the server, with the number of collector results
+// it holds
+type outgoing struct {
+	payload protocol.MetricsPayload
+	results int
+}
+
+// bounded queues of collector results and of the payloads built from them,
+// applying the backpressure policy when delivery falls behind
+type resultQueue struct {
+	ch       chan collectorResult
+	payloads chan outgoing // waiting for the delivery goroutine
+	policy   string
+
+	dropped    atomic.Uint64 // results discarded under drop_oldest
+	blocked    atomic.Uint64 // pushes and payloads that had to wait under block
+	superseded atomic.Uint64 // results replaced by a newer one before being sent
+}
+
+func newResultQueue(config QueueConfig) *resultQueue {
+	return &resultQueue{
+		ch:       make(chan collectorResult, config.Size),
+		payloads: make(chan outgoing, config.Payloads),
+		policy:   config.Policy,
+	}
+}
+
+func (q *resultQueue) push(result collectorResult) {
+	select {
+	case q.ch <- result:
+		return
+	default:
+	}
+
+	if q.policy == PolicyBlock {
+		q.blocked.Add(1)
+		q.ch <- result
+		return
+	}
+
+	for {
+		select {
+		case <-q.ch:
+			q.dropped.Add(1)
+		default:
+		}
+
+		select {
+		case q.ch <- result:
+			return
+		default:
+		}
+	}
+}
+
+// queue state as agent self-metrics
+func (q *resultQueue) metrics(now time.Time) []protocol.Metric {
+	labels := map[string]string{"policy": q.policy}
+
+	return []protocol.Metric{
+		selfMetric("agent_queue_length", float64(len(q.ch)), protocol.MetricTypeGauge, "", labels, now),
+		selfMetric("agent_queue_capacity", float64(cap(q.ch)), protocol.MetricTypeGauge, "", labels, now),
+		selfMetric("agent_queue_payloads", float64(len(q.payloads)), protocol.MetricTypeGauge, "", labels, now),
+		selfMetric("agent_queue_payloads_capacity", float64(cap(q.payloads)), protocol.MetricTypeGauge, "", labels, now),
+		selfMetric("agent_queue_dropped_total", float64(q.dropped.Load()), protocol.MetricTypeCounter, "", labels, now),
+		selfMetric("agent_queue_blocked_total", float64(q.blocked.Load()), protocol.MetricTypeCounter, "", labels, now),
+		selfMetric("agent_queue_superseded_total", float64(q.superseded.Load()), protocol.MetricTypeCounter, "", labels, now),
+	}
+}
+
+// a metric about the agent itself
+func selfMetric(name string, value float64, metricType, unit string, labels map[string]string, now time.Time) protocol.Metric {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	return protocol.Metric{
+		Name:      name,
+		Value:     value,
+		Timestamp: now,
+		Labels:    labels,
+		Type:      metricType,
+		Unit:      unit,
+	}
+}
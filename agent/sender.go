@@ -0,0 +1,269 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"ddgo/protocol"
+)
+
+// returned without contacting the server while the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open, server considered down")
+
+// retry and circuit breaker settings of the sender
+type SenderConfig struct {
+	Timeout        time.Duration `yaml:"timeout"`      // per request
+	MaxAttempts    int           `yaml:"max_attempts"` // per payload, including the first
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+
+	// consecutive failed payloads that open the breaker, and how long it
+	// stays open before a single probe request is let through
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+}
+
+func DefaultSenderConfig() SenderConfig {
+	return SenderConfig{
+		Timeout:          10 * time.Second,
+		MaxAttempts:      4,
+		InitialBackoff:   500 * time.Millisecond,
+		MaxBackoff:       30 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+func (c SenderConfig) validate() []string {
+	problems := []string{}
+
+	if c.Timeout <= 0 {
+		problems = append(problems, fmt.Sprintf("sender.timeout: must be positive, got %s", c.Timeout))
+	}
+	if c.MaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("sender.max_attempts: must be at least 1, got %d", c.MaxAttempts))
+	}
+	if c.InitialBackoff <= 0 || c.MaxBackoff < c.InitialBackoff {
+		problems = append(problems, fmt.Sprintf("sender: backoff must satisfy 0 < initial_backoff (%s) <= max_backoff (%s)",
+			c.InitialBackoff, c.MaxBackoff))
+	}
+	if c.BreakerThreshold < 1 {
+		problems = append(problems, fmt.Sprintf("sender.breaker_threshold: must be at least 1, got %d", c.BreakerThreshold))
+	}
+	if c.BreakerCooldown <= 0 {
+		problems = append(problems, fmt.Sprintf("sender.breaker_cooldown: must be positive, got %s", c.BreakerCooldown))
+	}
+
+	return problems
+}
+
+// posts payloads to the server, retrying transient failures with jittered
+// exponential backoff and backing off entirely once the server looks down
+type Sender struct {
+	url      string
+	client   *http.Client
+	config   SenderConfig
+	encoding string // Content-Encoding of request bodies, "" for none
+
+	failures  int // consecutive failed payloads
+	openUntil time.Time
+	mutex     sync.Mutex
+}
+
+// error status from the server, with the delay it asked for if any
+type statusError struct {
+	status     string
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server returned status: %s", e.status)
+}
+
+func CreateSender(url string, transport http.RoundTripper, config SenderConfig, encoding string) *Sender {
+	return &Sender{
+		url: url,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   config.Timeout,
+		},
+		config:   config,
+		encoding: encoding,
+	}
+}
+
+func (s *Sender) Send(data []byte) error {
+	attempts, err := s.allow()
+	if err != nil {
+		return err
+	}
+
+	body, err := protocol.Compress(data, s.encoding)
+	if err != nil {
+		return fmt.Errorf("failed to compress metrics: %v", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = s.post(body)
+		if err == nil {
+			s.record(true)
+			return nil
+		}
+
+		if !retryable(err) {
+			// the server is up but rejected the payload, retrying won't help
+			return err
+		}
+
+		if attempt >= attempts {
+			s.record(false)
+			return fmt.Errorf("giving up after %d attempts: %v", attempt, err)
+		}
+
+		wait := s.backoff(attempt)
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.retryAfter > wait {
+			// longer than we would ever back off, stop sending until then
+			// instead of stalling in Sleep
+			if statusErr.retryAfter > s.config.MaxBackoff {
+				s.hold(statusErr.retryAfter)
+				return fmt.Errorf("server asked to retry after %s: %v", statusErr.retryAfter, err)
+			}
+			wait = statusErr.retryAfter
+		}
+
+		log.Printf("Send attempt %d/%d failed, retrying in %s: %v", attempt, attempts, wait.Round(time.Millisecond), err)
+		time.Sleep(wait)
+	}
+}
+
+// attempts allowed for the next payload: none while the breaker is open,
+// a single probe right after it closes, the configured number otherwise
+func (s *Sender) allow() (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.failures < s.config.BreakerThreshold {
+		return s.config.MaxAttempts, nil
+	}
+
+	if time.Now().Before(s.openUntil) {
+		return 0, ErrCircuitOpen
+	}
+
+	return 1, nil
+}
+
+func (s *Sender) record(success bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if success {
+		if s.failures >= s.config.BreakerThreshold {
+			log.Printf("Server reachable again, closing circuit breaker")
+		}
+		s.failures = 0
+		return
+	}
+
+	s.failures++
+	if s.failures >= s.config.BreakerThreshold {
+		s.openUntil = time.Now().Add(s.config.BreakerCooldown)
+		log.Printf("%d consecutive failed sends, opening circuit breaker for %s", s.failures, s.config.BreakerCooldown)
+	}
+}
+
+// open the breaker for at least wait, as asked for by the server
+func (s *Sender) hold(wait time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.failures < s.config.BreakerThreshold {
+		s.failures = s.config.BreakerThreshold
+	}
+	if until := time.Now().Add(wait); until.After(s.openUntil) {
+		s.openUntil = until
+	}
+	log.Printf("Server asked to retry after %s, opening circuit breaker until then", wait)
+}
+
+func (s *Sender) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.encoding != "" {
+		req.Header.Set("Content-Encoding", s.encoding)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // drain so the connection is reused
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{
+			status:     resp.Status,
+			code:       resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	return nil
+}
+
+// network errors, 429 and 5xx are worth retrying, other statuses are not
+func retryable(err error) bool {
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+
+	return statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500
+}
+
+// exponential backoff with equal jitter: a random delay between half and
+// all of initial * 2^(attempt-1), capped at max
+func (s *Sender) backoff(attempt int) time.Duration {
+	delay := s.config.InitialBackoff
+	for i := 1; i < attempt && delay < s.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.config.MaxBackoff {
+		delay = s.config.MaxBackoff
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// Retry-After is either a number of seconds or an http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ddgo/protocol"
+)
+
+// server replying with the given responses in turn, then 200
+type scriptedServer struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newScriptedServer(t *testing.T, responses ...func(http.ResponseWriter)) *scriptedServer {
+	s := &scriptedServer{}
+
+	var mutex sync.Mutex
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		s.requests.Add(1)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if len(responses) == 0 {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		respond := responses[0]
+		responses = responses[1:]
+		respond(w)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func status(code int, retryAfter string) func(http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(code)
+	}
+}
+
+func testSenderConfig() SenderConfig {
+	return SenderConfig{
+		Timeout:          time.Second,
+		MaxAttempts:      3,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+		BreakerThreshold: 2,
+		BreakerCooldown:  50 * time.Millisecond,
+	}
+}
+
+func TestSenderRetriesWithRetryAfter(t *testing.T) {
+	for _, code := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		server := newScriptedServer(t, status(code, "1"))
+		sender := CreateSender(server.URL, nil, testSenderConfig(), "")
+
+		started := time.Now()
+		if err := sender.Send([]byte("{}")); err != nil {
+			t.Fatalf("%d: Send: %v", code, err)
+		}
+
+		if n := server.requests.Load(); n != 2 {
+			t.Errorf("%d: got %d requests, want 2", code, n)
+		}
+		if elapsed := time.Since(started); elapsed < time.Second {
+			t.Errorf("%d: retried after %s, want at least the 1s Retry-After", code, elapsed)
+		}
+	}
+}
+
+func TestSenderLongRetryAfterOpensBreaker(t *testing.T) {
+	server := newScriptedServer(t, status(http.StatusServiceUnavailable, "86400"))
+	sender := CreateSender(server.URL, nil, testSenderConfig(), "")
+
+	started := time.Now()
+	err := sender.Send([]byte("{}"))
+	if err == nil || !strings.Contains(err.Error(), "retry after") {
+		t.Fatalf("Send = %v, want a retry after error", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Send took %s, want it to return without waiting", elapsed)
+	}
+
+	// held open well past the cooldown
+	time.Sleep(2 * testSenderConfig().BreakerCooldown)
+	if err := sender.Send([]byte("{}")); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Send during Retry-After = %v, want ErrCircuitOpen", err)
+	}
+	if n := server.requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestSenderClientErrorNotRetried(t *testing.T) {
+	reject := status(http.StatusBadRequest, "")
+	server := newScriptedServer(t, reject, reject, reject)
+	sender := CreateSender(server.URL, nil, testSenderConfig(), "")
+
+	// more rejections than breaker_threshold, each sent once
+	for i := 0; i < 3; i++ {
+		err := sender.Send([]byte("{}"))
+		if err == nil || retryable(err) {
+			t.Fatalf("Send %d = %v, want a non-retryable error", i, err)
+		}
+		if n := server.requests.Load(); n != int32(i+1) {
+			t.Fatalf("got %d requests after %d sends, want %d", n, i+1, i+1)
+		}
+	}
+
+	// the server is up, so rejected payloads do not open the breaker
+	if err := sender.Send([]byte("{}")); err != nil {
+		t.Errorf("Send after rejected payloads = %v, want nil", err)
+	}
+}
+
+func TestSenderCircuitBreaker(t *testing.T) {
+	config := testSenderConfig()
+	config.MaxAttempts = 2
+
+	fail := status(http.StatusInternalServerError, "")
+	server := newScriptedServer(t, fail, fail, fail, fail, fail)
+	sender := CreateSender(server.URL, nil, config, "")
+
+	// breaker_threshold failed payloads open the breaker
+	for i := 0; i < config.BreakerThreshold; i++ {
+		if err := sender.Send([]byte("{}")); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Send %d = %v, want a server error", i, err)
+		}
+	}
+	if n := server.requests.Load(); n != 4 {
+		t.Fatalf("got %d requests, want 4", n)
+	}
+
+	// open: nothing is sent
+	if err := sender.Send([]byte("{}")); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Send while open = %v, want ErrCircuitOpen", err)
+	}
+	if n := server.requests.Load(); n != 4 {
+		t.Fatalf("got %d requests while open, want 4", n)
+	}
+
+	// half open: a single probe, which fails and reopens the breaker
+	time.Sleep(config.BreakerCooldown + 10*time.Millisecond)
+	if err := sender.Send([]byte("{}")); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("probe = %v, want a server error", err)
+	}
+	if n := server.requests.Load(); n != 5 {
+		t.Fatalf("got %d requests after the probe, want 5", n)
+	}
+	if err := sender.Send([]byte("{}")); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Send after a failed probe = %v, want ErrCircuitOpen", err)
+	}
+
+	// a successful probe closes it again
+	time.Sleep(config.BreakerCooldown + 10*time.Millisecond)
+	if err := sender.Send([]byte("{}")); err != nil {
+		t.Fatalf("probe = %v, want nil", err)
+	}
+	if err := sender.Send([]byte("{}")); err != nil {
+		t.Fatalf("Send after closing = %v, want nil", err)
+	}
+}
+
+func TestSenderCompression(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader, err := protocol.Decompress(r.Body, r.Header.Get("Content-Encoding"))
+		if err != nil {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ = io.ReadAll(reader)
+	}))
+	defer server.Close()
+
+	sender := CreateSender(server.URL, nil, testSenderConfig(), protocol.EncodingGzip)
+	if err := sender.Send([]byte(`{"agent_id":"a"}`)); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if string(body) != `{"agent_id":"a"}` {
+		t.Errorf("server got %q", body)
+	}
+}
+
+func TestSenderBackoff(t *testing.T) {
+	config := testSenderConfig()
+	config.InitialBackoff = 100 * time.Millisecond
+	config.MaxBackoff = time.Second
+	sender := CreateSender("http://localhost", nil, config, "")
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+		time.Second,
+	}
+
+	for i, delay := range expected {
+		for n := 0; n < 50; n++ {
+			if wait := sender.backoff(i + 1); wait < delay/2 || wait > delay {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", i+1, wait, delay/2, delay)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if wait := parseRetryAfter("3"); wait != 3*time.Second {
+		t.Errorf("parseRetryAfter(3) = %s, want 3s", wait)
+	}
+
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if wait := parseRetryAfter(date); wait < 8*time.Second || wait > 10*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %s, want about 10s", date, wait)
+	}
+
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	for _, value := range []string{"", "0", "-5", "soon", past} {
+		if wait := parseRetryAfter(value); wait != 0 {
+			t.Errorf("parseRetryAfter(%q) = %s, want 0", value, wait)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ddgo/protocol"
+)
+
+// bounds of the on-disk queue of unsent payloads
+type SpoolConfig struct {
+	Dir      string        `yaml:"dir"` // empty disables spooling
+	MaxBytes int64         `yaml:"max_bytes"`
+	MaxAge   time.Duration `yaml:"max_age"`
+
+	// payloads replayed per send, so a long backlog drains over several
+	// intervals instead of holding up the current payload
+	ReplayBatch int `yaml:"replay_batch"`
+}
+
+func DefaultSpoolConfig() SpoolConfig {
+	return SpoolConfig{
+		Dir:      "/var/lib/ddgo/spool",
+		MaxBytes: 64 << 20,
+		MaxAge:   24 * time.Hour,
+
+		ReplayBatch: 10,
+	}
+}
+
+func (c SpoolConfig) validate() []string {
+	problems := []string{}
+
+	if c.Dir == "" {
+		return problems
+	}
+	if c.MaxBytes <= 0 {
+		problems = append(problems, fmt.Sprintf("spool.max_bytes: must be positive, got %d", c.MaxBytes))
+	}
+	if c.MaxAge <= 0 {
+		problems = append(problems, fmt.Sprintf("spool.max_age: must be positive, got %s", c.MaxAge))
+	}
+	if c.ReplayBatch < 1 {
+		problems = append(problems, fmt.Sprintf("spool.replay_batch: must be at least 1, got %d", c.ReplayBatch))
+	}
+
+	return problems
+}
+
+// payloads that could not be delivered, one file per payload, named after
+// the time they were queued so that sorting by name gives delivery order.
+// the oldest payloads are evicted once the queue exceeds its size or age
+// limit
+type Spool struct {
+	config  SpoolConfig
+	entries []spoolEntry // oldest first
+	size    int64
+	seq     int
+
+	buffered uint64
+	replayed uint64
+	dropped  uint64
+	mutex    sync.Mutex
+}
+
+type spoolEntry struct {
+	name   string
+	size   int64
+	queued time.Time
+}
+
+// counters since the agent started, plus the current backlog
+type SpoolStats struct {
+	Buffered     uint64
+	Replayed     uint64
+	Dropped      uint64
+	Pending      int
+	PendingBytes int64
+}
+
+// open the spool directory, picking up payloads left by a previous run
+func OpenSpool(config SpoolConfig) (*Spool, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating spool directory: %v", err)
+	}
+
+	files, err := os.ReadDir(config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading spool directory: %v", err)
+	}
+
+	s := &Spool{config: config}
+	for _, file := range files {
+		// left behind by a crash in the middle of a push
+		if strings.HasSuffix(file.Name(), ".tmp") {
+			os.Remove(filepath.Join(config.Dir, file.Name()))
+			continue
+		}
+
+		queued, ok := parseSpoolName(file.Name())
+		if !ok || !file.Type().IsRegular() {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		s.entries = append(s.entries, spoolEntry{name: file.Name(), size: info.Size(), queued: queued})
+		s.size += info.Size()
+	}
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].name < s.entries[j].name })
+
+	s.mutex.Lock()
+	s.evict(time.Now())
+	s.mutex.Unlock()
+
+	return s, nil
+}
+
+// <unix nanoseconds>-<sequence>.json, zero padded so names sort by time
+func parseSpoolName(name string) (time.Time, bool) {
+	stamp, _, ok := strings.Cut(strings.TrimSuffix(name, ".json"), "-")
+	if !ok || !strings.HasSuffix(name, ".json") {
+		return time.Time{}, false
+	}
+
+	nanos, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, nanos), true
+}
+
+// queue a payload, evicting the oldest ones if the spool is over its limits
+func (s *Spool) Push(data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.seq++
+	name := fmt.Sprintf("%020d-%06d.json", now.UnixNano(), s.seq%1000000)
+	path := filepath.Join(s.config.Dir, name)
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		s.dropped++
+		return fmt.Errorf("error writing spool file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		s.dropped++
+		return fmt.Errorf("error writing spool file: %v", err)
+	}
+
+	s.entries = append(s.entries, spoolEntry{name: name, size: int64(len(data)), queued: now})
+	s.size += int64(len(data))
+	s.buffered++
+	s.evict(now)
+
+	return nil
+}
+
+// drop expired payloads, then the oldest until the spool fits, s.mutex
+// must be held
+func (s *Spool) evict(now time.Time) {
+	for len(s.entries) > 0 {
+		oldest := s.entries[0]
+		if now.Sub(oldest.queued) <= s.config.MaxAge && s.size <= s.config.MaxBytes {
+			return
+		}
+		s.remove()
+		s.dropped++
+	}
+}
+
+// delete the oldest entry, s.mutex must be held
+func (s *Spool) remove() {
+	oldest := s.entries[0]
+	if err := os.Remove(filepath.Join(s.config.Dir, oldest.name)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: error removing spool file %s: %v\n", oldest.name, err)
+	}
+
+	s.entries = s.entries[1:]
+	s.size -= oldest.size
+}
+
+func (s *Spool) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.entries)
+}
+
+// send up to replay_batch queued payloads oldest first, stopping at the
+// first one the server does not accept for a transient reason. payloads it
+// rejects outright are dropped, since replaying them again would never
+// succeed. the rest of the backlog is left for the next call
+func (s *Spool) Replay(send func([]byte) error) (int, error) {
+	replayed := 0
+
+	for attempts := 0; attempts < s.config.ReplayBatch; attempts++ {
+		s.mutex.Lock()
+		s.evict(time.Now())
+		if len(s.entries) == 0 {
+			s.mutex.Unlock()
+			return replayed, nil
+		}
+		oldest := s.entries[0]
+		s.mutex.Unlock()
+
+		data, readErr := os.ReadFile(filepath.Join(s.config.Dir, oldest.name))
+		var err error
+		if readErr == nil {
+			err = send(data)
+		}
+
+		s.mutex.Lock()
+		if len(s.entries) == 0 || s.entries[0].name != oldest.name {
+			// evicted by a concurrent push while we were sending
+			s.mutex.Unlock()
+			continue
+		}
+
+		// only server errors stop the replay, a file that cannot be read
+		// now never will be
+		switch {
+		case readErr != nil:
+			if !os.IsNotExist(readErr) {
+				fmt.Printf("Warning: dropping unreadable spool file %s: %v\n", oldest.name, readErr)
+			}
+			s.remove()
+			s.dropped++
+		case err == nil:
+			s.remove()
+			s.replayed++
+			replayed++
+		case !retryable(err):
+			s.remove()
+			s.dropped++
+		default:
+			s.mutex.Unlock()
+			return replayed, err
+		}
+		s.mutex.Unlock()
+	}
+
+	return replayed, nil
+}
+
+func (s *Spool) Stats() SpoolStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return SpoolStats{
+		Buffered:     s.buffered,
+		Replayed:     s.replayed,
+		Dropped:      s.dropped,
+		Pending:      len(s.entries),
+		PendingBytes: s.size,
+	}
+}
+
+// the stats as agent self-metrics
+func (st SpoolStats) metrics(now time.Time) []protocol.Metric {
+	return []protocol.Metric{
+		selfMetric("agent_spool_buffered_total", float64(st.Buffered), protocol.MetricTypeCounter, "", nil, now),
+		selfMetric("agent_spool_replayed_total", float64(st.Replayed), protocol.MetricTypeCounter, "", nil, now),
+		selfMetric("agent_spool_dropped_total", float64(st.Dropped), protocol.MetricTypeCounter, "", nil, now),
+		selfMetric("agent_spool_pending", float64(st.Pending), protocol.MetricTypeGauge, "", nil, now),
+		selfMetric("agent_spool_pending_bytes", float64(st.PendingBytes), protocol.MetricTypeGauge, "bytes", nil, now),
+	}
+}
@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testSpoolConfig(dir string) SpoolConfig {
+	config := DefaultSpoolConfig()
+	config.Dir = dir
+	return config
+}
+
+func openTestSpool(t *testing.T, config SpoolConfig) *Spool {
+	t.Helper()
+
+	spool, err := OpenSpool(config)
+	if err != nil {
+		t.Fatalf("OpenSpool: %v", err)
+	}
+	return spool
+}
+
+func pushAll(t *testing.T, spool *Spool, payloads ...string) {
+	t.Helper()
+
+	for _, payload := range payloads {
+		if err := spool.Push([]byte(payload)); err != nil {
+			t.Fatalf("Push(%s): %v", payload, err)
+		}
+	}
+}
+
+// replay everything, returning the payloads in the order they were sent
+func replayAll(t *testing.T, spool *Spool) []string {
+	t.Helper()
+
+	sent := []string{}
+	for spool.Len() > 0 {
+		if _, err := spool.Replay(func(data []byte) error {
+			sent = append(sent, string(data))
+			return nil
+		}); err != nil {
+			t.Fatalf("Replay: %v", err)
+		}
+	}
+	return sent
+}
+
+func TestSpoolOrderAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+
+	first := openTestSpool(t, testSpoolConfig(dir))
+	pushAll(t, first, "1", "2", "3")
+
+	// a crash in the middle of a push, and files that are not payloads
+	os.WriteFile(filepath.Join(dir, "00000000000000000001-000001.json.tmp"), []byte("partial"), 0644)
+	os.WriteFile(filepath.Join(dir, "README"), []byte("not a payload"), 0644)
+	os.Mkdir(filepath.Join(dir, "00000000000000000002-000001.json"), 0755)
+
+	second := openTestSpool(t, testSpoolConfig(dir))
+	if n := second.Len(); n != 3 {
+		t.Fatalf("reopened spool has %d payloads, want 3", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00000000000000000001-000001.json.tmp")); !os.IsNotExist(err) {
+		t.Errorf("leftover .tmp file not removed: %v", err)
+	}
+
+	pushAll(t, second, "4")
+
+	sent := replayAll(t, second)
+	if fmt.Sprint(sent) != "[1 2 3 4]" {
+		t.Errorf("replayed %v, want [1 2 3 4]", sent)
+	}
+
+	stats := second.Stats()
+	if stats.Replayed != 4 || stats.Pending != 0 || stats.PendingBytes != 0 {
+		t.Errorf("stats = %+v, want 4 replayed and nothing pending", stats)
+	}
+}
+
+func TestSpoolSizeEviction(t *testing.T) {
+	config := testSpoolConfig(t.TempDir())
+	config.MaxBytes = 10
+
+	spool := openTestSpool(t, config)
+	pushAll(t, spool, "aaaa", "bbbb", "cccc")
+
+	stats := spool.Stats()
+	if stats.Pending != 2 || stats.PendingBytes != 8 || stats.Dropped != 1 {
+		t.Errorf("stats = %+v, want 2 pending, 8 bytes, 1 dropped", stats)
+	}
+
+	if sent := replayAll(t, spool); fmt.Sprint(sent) != "[bbbb cccc]" {
+		t.Errorf("replayed %v, want the newest two", sent)
+	}
+}
+
+func TestSpoolAgeEviction(t *testing.T) {
+	dir := t.TempDir()
+	config := testSpoolConfig(dir)
+	config.MaxAge = time.Hour
+
+	// queued two hours ago by a previous run
+	old := fmt.Sprintf("%020d-%06d.json", time.Now().Add(-2*time.Hour).UnixNano(), 1)
+	if err := os.WriteFile(filepath.Join(dir, old), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spool := openTestSpool(t, config)
+	if n := spool.Len(); n != 0 {
+		t.Errorf("expired payload picked up, %d pending", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, old)); !os.IsNotExist(err) {
+		t.Errorf("expired payload not removed: %v", err)
+	}
+
+	// and payloads expiring while queued are dropped before replay
+	config.MaxAge = 20 * time.Millisecond
+	spool = openTestSpool(t, config)
+	pushAll(t, spool, "stale")
+	time.Sleep(30 * time.Millisecond)
+
+	if sent := replayAll(t, spool); len(sent) != 0 {
+		t.Errorf("replayed expired payloads %v", sent)
+	}
+	if stats := spool.Stats(); stats.Dropped != 1 {
+		t.Errorf("stats = %+v, want 1 dropped", stats)
+	}
+}
+
+func TestSpoolReplayBatch(t *testing.T) {
+	config := testSpoolConfig(t.TempDir())
+	config.ReplayBatch = 2
+
+	spool := openTestSpool(t, config)
+	pushAll(t, spool, "1", "2", "3", "4", "5")
+
+	replayed, err := spool.Replay(func([]byte) error { return nil })
+	if err != nil || replayed != 2 {
+		t.Fatalf("Replay = %d, %v, want 2, nil", replayed, err)
+	}
+	if n := spool.Len(); n != 3 {
+		t.Errorf("%d pending after one batch, want 3", n)
+	}
+}
+
+func TestSpoolReplayErrors(t *testing.T) {
+	dir := t.TempDir()
+	spool := openTestSpool(t, testSpoolConfig(dir))
+	pushAll(t, spool, "unreadable", "rejected", "unavailable", "ok")
+
+	// replace the oldest payload with something that cannot be read
+	head := filepath.Join(dir, spool.entries[0].name)
+	os.Remove(head)
+	if err := os.Mkdir(head, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := map[string]error{
+		"rejected":    &statusError{status: "400 Bad Request", code: http.StatusBadRequest},
+		"unavailable": &statusError{status: "503 Service Unavailable", code: http.StatusServiceUnavailable},
+	}
+	sent := []string{}
+	send := func(data []byte) error {
+		sent = append(sent, string(data))
+		err := responses[string(data)]
+		delete(responses, string(data))
+		return err
+	}
+
+	// the unreadable and rejected payloads are dropped, the server error
+	// stops the replay with the payload still queued
+	replayed, err := spool.Replay(send)
+	if err == nil || replayed != 0 {
+		t.Fatalf("Replay = %d, %v, want 0 and the 503", replayed, err)
+	}
+	if fmt.Sprint(sent) != "[rejected unavailable]" {
+		t.Errorf("sent %v, want [rejected unavailable]", sent)
+	}
+	if stats := spool.Stats(); stats.Dropped != 2 || stats.Pending != 2 {
+		t.Errorf("stats = %+v, want 2 dropped and 2 pending", stats)
+	}
+
+	replayed, err = spool.Replay(send)
+	if err != nil || replayed != 2 {
+		t.Errorf("second Replay = %d, %v, want 2, nil", replayed, err)
+	}
+}
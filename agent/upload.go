@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"ddgo/protocol"
+)
+
+// how payloads are grouped and encoded into requests
+type UploadConfig struct {
+	Compression  string `yaml:"compression"`    // "", gzip or zstd
+	MaxBatchSize int    `yaml:"max_batch_size"` // payloads per request, 1 disables batching
+
+	// longest a payload waits for its batch to fill up
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+func DefaultUploadConfig() UploadConfig {
+	return UploadConfig{
+		MaxBatchSize:  1,
+		FlushInterval: 30 * time.Second,
+	}
+}
+
+func (c UploadConfig) validate() []string {
+	problems := []string{}
+
+	switch c.Compression {
+	case "", protocol.EncodingGzip, protocol.EncodingZstd:
+	default:
+		problems = append(problems, fmt.Sprintf("upload.compression: unsupported %q, expected gzip or zstd", c.Compression))
+	}
+	if c.MaxBatchSize < 1 {
+		problems = append(problems, fmt.Sprintf("upload.max_batch_size: must be at least 1, got %d", c.MaxBatchSize))
+	}
+	if c.MaxBatchSize > 1 && c.FlushInterval <= 0 {
+		problems = append(problems, fmt.Sprintf("upload.flush_interval: must be positive when batching, got %s", c.FlushInterval))
+	}
+
+	return problems
+}
+
+func (c UploadConfig) batching() bool {
+	return c.MaxBatchSize > 1
+}
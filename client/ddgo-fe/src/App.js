@@ -84,8 +84,8 @@ const DiskIOChart = ({ data }) => {
     useEffect(() => {
         setHistoricalData(prev => [...prev, {
             time: new Date().toLocaleTimeString(),
-            read: data.io.read_bytes,
-            write: data.io.write_bytes
+            read: data.read_bytes_per_second,
+            write: data.write_bytes_per_second
         }].slice(-20));
     }, [data]);
 
@@ -226,11 +226,13 @@ function App() {
                             </MetricCard>
                         </Box>
 
-                        <Box gridColumn="span 12">
-                            <MetricCard title="Disk I/O">
-                                <DiskIOChart data={agentMetrics.metrics.disk} />
-                            </MetricCard>
-                        </Box>
+                        {Object.entries(agentMetrics.metrics.disk || {}).sort().map(([device, deviceMetrics]) => (
+                            <Box key={device} gridColumn="span 12">
+                                <MetricCard title={`Disk I/O (${device})`}>
+                                    <DiskIOChart data={deviceMetrics} />
+                                </MetricCard>
+                            </Box>
+                        ))}
                     </Grid>
                 </Box>
             ))}
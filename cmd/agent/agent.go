@@ -2,20 +2,61 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"ddgo/agent"
+	"ddgo/internal/collector"
 )
 
 func main() {
-	// command-line flag for the server URL with a default value of "http://localhost:8080".
-	serverURL := flag.String("server", "http://localhost:8080", "URL of the central metrics server")
+	// command-line flag for the config file, also settable through DDGO_CONFIG.
+	configPath := flag.String("config", os.Getenv("DDGO_CONFIG"), "path to a yaml config file (env DDGO_CONFIG)")
+
+	// only check the config and exit.
+	validate := flag.Bool("validate", false, "validate the configuration and exit")
+
+	// command-line flag for the server URL, overriding the config file.
+	serverURL := flag.String("server", "", "URL of the central metrics server (default \"http://localhost:8080\")")
+
+	// command-line flag for the collectors to run, overriding the config file.
+	collectors := flag.String("collectors", "", fmt.Sprintf(
+		"comma-separated collectors to enable (available: %s; default: %s)",
+		strings.Join(collector.Names(), ", "),
+		strings.Join(collector.DefaultNames(), ", "),
+	))
 
 	// parse the command-line flags.
 	flag.Parse()
 
-	// create a new agent instance with the specified server URL.
-	a, err := agent.NewAgent(*serverURL)
+	// load the config file and environment overrides, then apply flags.
+	config, err := agent.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "server":
+			config.Server = *serverURL
+		case "collectors":
+			config.SetCollectors(strings.Split(*collectors, ","))
+		}
+	})
+
+	if *validate {
+		if err := config.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("config OK")
+		return
+	}
+
+	// create a new agent instance from the config.
+	a, err := agent.NewAgent(config)
 	if err != nil {
 		log.Fatalf("Failed to create agent: %v", err)
 	}
@@ -36,6 +36,9 @@ func main() {
 	// endpoints
 	mux.HandleFunc("/api/metrics/collect", metricsServer.CollectAgents)
 	mux.HandleFunc("/api/metrics", metricsServer.GetMetrics)
+	mux.HandleFunc("/api/v2/metrics/collect", metricsServer.CollectAgentsV2)
+	mux.HandleFunc("/api/v2/metrics", metricsServer.GetMetricsV2)
+	mux.HandleFunc("/api/v2/events", metricsServer.GetEvents)
 
 	handler := startCORS(mux)
 
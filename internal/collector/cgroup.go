@@ -0,0 +1,260 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// per-cgroup resource usage from the cgroup v2 (unified) hierarchy
+type CgroupCollector struct {
+	rootPath string
+	maxDepth int // levels below rootPath to report, 0 means no limit. containers are reported at any depth
+
+	lastUsage   map[string]uint64
+	lastCollect time.Time
+	mutex       sync.Mutex
+}
+
+// docker, containerd, cri-o and podman all name container cgroups after the
+// 64 hex digit container id
+var containerIDPattern = regexp.MustCompile(`([0-9a-f]{64})`)
+
+func init() {
+	Register("cgroup", true, []string{"root_path", "max_depth"}, func(opts Options) (Collector, error) {
+		c := CreateCgroupCollector(opts.String("root_path", defaultCgroupRoot()))
+		c.maxDepth = opts.Int("max_depth", c.maxDepth)
+		return c, nil
+	})
+}
+
+// slices and their direct children by default, systemd hosts have hundreds
+// of scopes below that
+const defaultCgroupMaxDepth = 2
+
+func CreateCgroupCollector(rootPath string) *CgroupCollector {
+	return &CgroupCollector{
+		rootPath:  rootPath,
+		maxDepth:  defaultCgroupMaxDepth,
+		lastUsage: make(map[string]uint64),
+	}
+}
+
+// hybrid hosts mount the unified hierarchy under /sys/fs/cgroup/unified
+func defaultCgroupRoot() string {
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err != nil {
+		if _, err := os.Stat("/sys/fs/cgroup/unified/cgroup.controllers"); err == nil {
+			return "/sys/fs/cgroup/unified"
+		}
+	}
+
+	return "/sys/fs/cgroup"
+}
+
+func (c *CgroupCollector) Name() string {
+	return "cgroup"
+}
+
+func (c *CgroupCollector) Collect() ([]Metric, error) {
+	metrics := []Metric{}
+	now := time.Now()
+
+	// not a cgroup v2 hierarchy, nothing to report
+	if _, err := os.Stat(filepath.Join(c.rootPath, "cgroup.controllers")); err != nil {
+		return metrics, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timeSinceLastCollect := now.Sub(c.lastCollect).Seconds()
+	currentUsage := make(map[string]uint64)
+
+	err := filepath.WalkDir(c.rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// cgroups can disappear while we walk
+			if path != c.rootPath {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(c.rootPath, path)
+		if err != nil {
+			return nil
+		}
+
+		// the root cgroup duplicates the machine-wide collectors
+		if rel == "." {
+			return nil
+		}
+
+		// below max_depth only containers are reported, wherever they are
+		// nested (kubernetes puts them at depth 4). other scopes are leaves
+		// not worth walking, and a container's own children are skipped
+		deep := c.maxDepth > 0 && strings.Count(rel, string(filepath.Separator))+1 > c.maxDepth
+		if deep && !containerIDPattern.MatchString(d.Name()) {
+			if strings.HasSuffix(d.Name(), ".scope") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		cgroupPath := "/" + filepath.ToSlash(rel)
+		cgroupMetrics, usage := c.collectCgroup(path, cgroupPath, timeSinceLastCollect, now)
+		metrics = append(metrics, cgroupMetrics...)
+		if usage > 0 {
+			currentUsage[cgroupPath] = usage
+		}
+
+		if deep {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking cgroup hierarchy %s: %v", c.rootPath, err)
+	}
+
+	c.lastUsage = currentUsage
+	c.lastCollect = now
+
+	return metrics, nil
+}
+
+// metrics of a single cgroup directory, plus its cumulative cpu usage in
+// microseconds for the next rate calculation
+func (c *CgroupCollector) collectCgroup(dir, cgroupPath string, seconds float64, now time.Time) ([]Metric, uint64) {
+	metrics := []Metric{}
+
+	labels := map[string]string{"cgroup": cgroupPath}
+	if match := containerIDPattern.FindString(filepath.Base(dir)); match != "" {
+		labels["container_id"] = match
+	}
+
+	add := func(name string, value float64) {
+		metrics = append(metrics, Metric{
+			Name:      name,
+			Value:     value,
+			Timestamp: now,
+			Labels:    labels,
+		})
+	}
+
+	var usage uint64
+	if cpuStat, err := readKeyValueFile(filepath.Join(dir, "cpu.stat")); err == nil {
+		usage = cpuStat["usage_usec"]
+
+		add("cgroup_cpu_usage_seconds_total", float64(cpuStat["usage_usec"])/1e6)
+		add("cgroup_cpu_user_seconds_total", float64(cpuStat["user_usec"])/1e6)
+		add("cgroup_cpu_system_seconds_total", float64(cpuStat["system_usec"])/1e6)
+		add("cgroup_cpu_periods_total", float64(cpuStat["nr_periods"]))
+		add("cgroup_cpu_throttled_periods_total", float64(cpuStat["nr_throttled"]))
+		add("cgroup_cpu_throttled_seconds_total", float64(cpuStat["throttled_usec"])/1e6)
+
+		// 100 means one full cpu
+		if lastUsage, exists := c.lastUsage[cgroupPath]; exists && seconds > 0 {
+			add("cgroup_cpu_usage_percent", counterRate(usage, lastUsage, seconds)/1e6*100)
+		}
+	}
+
+	if current, err := readUintFile(filepath.Join(dir, "memory.current")); err == nil {
+		add("cgroup_memory_current_bytes", float64(current))
+	}
+
+	// "max" means unlimited and is not reported
+	if limit, err := readUintFile(filepath.Join(dir, "memory.max")); err == nil {
+		add("cgroup_memory_max_bytes", float64(limit))
+	}
+
+	if events, err := readKeyValueFile(filepath.Join(dir, "memory.events")); err == nil {
+		add("cgroup_memory_oom_events_total", float64(events["oom"]))
+		add("cgroup_memory_oom_kills_total", float64(events["oom_kill"]))
+	}
+
+	if ioStat, err := readCgroupIOStat(filepath.Join(dir, "io.stat")); err == nil {
+		add("cgroup_io_read_bytes_total", float64(ioStat["rbytes"]))
+		add("cgroup_io_write_bytes_total", float64(ioStat["wbytes"]))
+		add("cgroup_io_read_ops_total", float64(ioStat["rios"]))
+		add("cgroup_io_write_ops_total", float64(ioStat["wios"]))
+	}
+
+	return metrics, usage
+}
+
+// io.stat has one line per device:
+//
+//	8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+//
+// values are summed across devices
+func readCgroupIOStat(path string) (map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	totals := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		for _, field := range fields[1:] {
+			key, raw, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			if value, err := strconv.ParseUint(raw, 10, 64); err == nil {
+				totals[key] += value
+			}
+		}
+	}
+
+	return totals, scanner.Err()
+}
+
+// files of "key value" lines such as cpu.stat or memory.events
+func readKeyValueFile(path string) (map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = value
+		}
+	}
+
+	return values, scanner.Err()
+}
+
+// files holding a single number
+func readUintFile(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,242 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testContainerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// writes files relative to root, creating directories as needed
+func writeFixture(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// a small unified hierarchy: a slice, a container scope below it and a
+// cgroup nested too deep for the default max_depth
+func cgroupFixture(t *testing.T) string {
+	root := t.TempDir()
+
+	writeFixture(t, root, map[string]string{
+		"cgroup.controllers": "cpu io memory pids\n",
+		"cpu.stat":           "usage_usec 999999999\n",
+
+		"system.slice/cpu.stat": "usage_usec 2000000\nuser_usec 1500000\nsystem_usec 500000\n" +
+			"nr_periods 10\nnr_throttled 2\nthrottled_usec 250000\n",
+		"system.slice/memory.current": "1048576\n",
+		"system.slice/memory.max":     "max\n",
+		"system.slice/memory.events":  "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+		"system.slice/io.stat": "8:0 rbytes=1000 wbytes=2000 rios=10 wios=20 dbytes=0 dios=0\n" +
+			"8:16 rbytes=500 wbytes=0 rios=5 wios=0 dbytes=0 dios=0\n",
+
+		"system.slice/docker-" + testContainerID + ".scope/cpu.stat":   "usage_usec 1000000\n",
+		"system.slice/docker-" + testContainerID + ".scope/memory.max": "536870912\n",
+
+		"system.slice/docker-" + testContainerID + ".scope/nested/cpu.stat": "usage_usec 1\n",
+	})
+
+	return root
+}
+
+// metrics by name for one cgroup path
+func cgroupValues(metrics []Metric, cgroup string) map[string]Metric {
+	values := make(map[string]Metric)
+	for _, m := range metrics {
+		if m.Labels["cgroup"] == cgroup {
+			values[m.Name] = m
+		}
+	}
+	return values
+}
+
+func TestCgroupCollectorFixture(t *testing.T) {
+	c := CreateCgroupCollector(cgroupFixture(t))
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	slice := cgroupValues(metrics, "/system.slice")
+	expected := map[string]float64{
+		"cgroup_cpu_usage_seconds_total":     2,
+		"cgroup_cpu_user_seconds_total":      1.5,
+		"cgroup_cpu_system_seconds_total":    0.5,
+		"cgroup_cpu_periods_total":           10,
+		"cgroup_cpu_throttled_periods_total": 2,
+		"cgroup_cpu_throttled_seconds_total": 0.25,
+		"cgroup_memory_current_bytes":        1048576,
+		"cgroup_memory_oom_events_total":     1,
+		"cgroup_memory_oom_kills_total":      1,
+		"cgroup_io_read_bytes_total":         1500,
+		"cgroup_io_write_bytes_total":        2000,
+		"cgroup_io_read_ops_total":           15,
+		"cgroup_io_write_ops_total":          20,
+	}
+	for name, value := range expected {
+		m, ok := slice[name]
+		if !ok {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		if m.Value != value {
+			t.Errorf("%s = %v, want %v", name, m.Value, value)
+		}
+	}
+
+	// unlimited memory is not reported, nor is a rate on the first collect
+	for _, name := range []string{"cgroup_memory_max_bytes", "cgroup_cpu_usage_percent"} {
+		if _, ok := slice[name]; ok {
+			t.Errorf("unexpected %s", name)
+		}
+	}
+
+	scopePath := "/system.slice/docker-" + testContainerID + ".scope"
+	scope := cgroupValues(metrics, scopePath)
+	if m, ok := scope["cgroup_memory_max_bytes"]; !ok || m.Value != 536870912 {
+		t.Errorf("cgroup_memory_max_bytes = %v, want 536870912", m.Value)
+	}
+	if id := scope["cgroup_cpu_usage_seconds_total"].Labels["container_id"]; id != testContainerID {
+		t.Errorf("container_id = %q, want %q", id, testContainerID)
+	}
+
+	for _, m := range metrics {
+		switch m.Labels["cgroup"] {
+		case "/system.slice", scopePath:
+		default:
+			t.Errorf("unexpected cgroup %q in %s", m.Labels["cgroup"], m.Name)
+		}
+	}
+}
+
+func TestCgroupCollectorMaxDepth(t *testing.T) {
+	root := cgroupFixture(t)
+	nested := "/system.slice/docker-" + testContainerID + ".scope/nested"
+
+	tests := []struct {
+		maxDepth int
+		want     bool
+	}{
+		{maxDepth: 1, want: false},
+		{maxDepth: 2, want: false},
+		{maxDepth: 3, want: true},
+		{maxDepth: 0, want: true},
+	}
+
+	for _, tt := range tests {
+		c := CreateCgroupCollector(root)
+		c.maxDepth = tt.maxDepth
+
+		metrics, err := c.Collect()
+		if err != nil {
+			t.Fatalf("Collect: %v", err)
+		}
+
+		if got := len(cgroupValues(metrics, nested)) > 0; got != tt.want {
+			t.Errorf("max_depth %d: nested reported = %v, want %v", tt.maxDepth, got, tt.want)
+		}
+	}
+}
+
+func TestCgroupCollectorUsagePercent(t *testing.T) {
+	root := cgroupFixture(t)
+	c := CreateCgroupCollector(root)
+
+	if _, err := c.Collect(); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	// half a cpu over the last two seconds
+	c.lastCollect = time.Now().Add(-2 * time.Second)
+	writeFixture(t, root, map[string]string{
+		"system.slice/cpu.stat": "usage_usec 3000000\n",
+	})
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	m, ok := cgroupValues(metrics, "/system.slice")["cgroup_cpu_usage_percent"]
+	if !ok {
+		t.Fatal("missing cgroup_cpu_usage_percent")
+	}
+	if m.Value < 45 || m.Value > 50 {
+		t.Errorf("cgroup_cpu_usage_percent = %v, want about 50", m.Value)
+	}
+}
+
+func TestCgroupCollectorNotUnified(t *testing.T) {
+	c := CreateCgroupCollector(t.TempDir())
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if len(metrics) != 0 {
+		t.Errorf("got %d metrics without cgroup.controllers, want 0", len(metrics))
+	}
+}
+
+// containers below max_depth are still reported, other deep cgroups are not
+func TestCgroupCollectorNestedContainers(t *testing.T) {
+	root := t.TempDir()
+	podSlice := "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice"
+	container := podSlice + "/cri-containerd-" + testContainerID + ".scope"
+
+	writeFixture(t, root, map[string]string{
+		"cgroup.controllers": "cpu io memory pids\n",
+
+		"kubepods.slice/cpu.stat":                             "usage_usec 5\n",
+		"kubepods.slice/kubepods-burstable.slice/cpu.stat":    "usage_usec 5\n",
+		"user.slice/user-1000.slice/cpu.stat":                 "usage_usec 1\n",
+		podSlice + "/cpu.stat":                                "usage_usec 4\n",
+		container + "/cpu.stat":                               "usage_usec 3\n",
+		container + "/child/cpu.stat":                         "usage_usec 2\n",
+		"user.slice/user-1000.slice/session-1.scope/cpu.stat": "usage_usec 1\n",
+	})
+
+	c := CreateCgroupCollector(root)
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	reported := make(map[string]bool)
+	for _, m := range metrics {
+		reported[m.Labels["cgroup"]] = true
+	}
+
+	expected := map[string]bool{
+		"/kubepods.slice":                             true,
+		"/kubepods.slice/kubepods-burstable.slice":    true,
+		"/" + podSlice:                                false,
+		"/" + container:                               true,
+		"/" + container + "/child":                    false,
+		"/user.slice/user-1000.slice":                 true,
+		"/user.slice/user-1000.slice/session-1.scope": false,
+	}
+	for path, want := range expected {
+		if reported[path] != want {
+			t.Errorf("%s reported = %v, want %v", path, reported[path], want)
+		}
+	}
+
+	scope := cgroupValues(metrics, "/"+container)
+	if id := scope["cgroup_cpu_usage_seconds_total"].Labels["container_id"]; id != testContainerID {
+		t.Errorf("container_id = %q, want %q", id, testContainerID)
+	}
+}
@@ -1,7 +1,11 @@
 package collector
 
 import (
+	"bufio"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -14,23 +18,74 @@ import (
 )
 
 type CPUCollector struct {
-	history     []Metric
-	historySize int
+	history            *seriesHistory
+	trendWindows       []time.Duration
+	sustainedThreshold float64
+	sustainedWindow    time.Duration
+	procPath           string
+
+	lastTimes       map[string]cpu.TimesStat
+	lastStat        procStat
+	lastStatCollect time.Time
 }
 
+func init() {
+	Register("cpu", true, []string{"history_size", "trend_windows", "sustained_threshold", "sustained_window", "proc_path"}, func(opts Options) (Collector, error) {
+		historySize := opts.Int("history_size", defaultCPUHistorySize)
+		if historySize < 1 {
+			return nil, fmt.Errorf("history_size: must be at least 1, got %v", opts["history_size"])
+		}
+
+		c := CreateCPUCollector(historySize)
+		c.trendWindows = opts.Durations("trend_windows", c.trendWindows)
+		if _, set := opts["trend_windows"]; set {
+			// Durations skips entries it cannot parse
+			if raw := opts.Strings("trend_windows", nil); raw == nil || len(raw) != len(c.trendWindows) {
+				return nil, fmt.Errorf("trend_windows: must be positive durations, got %v", opts["trend_windows"])
+			}
+		}
+		c.sustainedThreshold = opts.Float("sustained_threshold", c.sustainedThreshold)
+		if _, set := opts["sustained_window"]; set && opts.Duration("sustained_window", 0) <= 0 {
+			return nil, fmt.Errorf("sustained_window: must be a positive duration, got %v", opts["sustained_window"])
+		}
+		c.sustainedWindow = opts.Duration("sustained_window", c.sustainedWindow)
+		c.procPath = opts.String("proc_path", c.procPath)
+		return c, nil
+	})
+}
+
+// samples kept per series, five minutes at the default two second interval
+const defaultCPUHistorySize = 150
+
+// historySize is the number of samples kept per usage series for trend analysis
 func CreateCPUCollector(historySize int) *CPUCollector {
 	return &CPUCollector{
-		history:     make([]Metric, 0, historySize),
-		historySize: historySize,
+		history:            newSeriesHistory(historySize),
+		trendWindows:       []time.Duration{time.Minute, 5 * time.Minute},
+		sustainedThreshold: 90,
+		sustainedWindow:    time.Minute,
+		procPath:           "/proc",
+		lastTimes:          make(map[string]cpu.TimesStat),
 	}
 }
 
+func (c *CPUCollector) Name() string {
+	return "cpu"
+}
+
 func (c *CPUCollector) Collect() ([]Metric, error) {
 	metrics := []Metric{}
 	now := time.Now()
 
+	// per-cpu time counters, shared by the usage and times metrics
+	perCPU, err := cpu.Times(true)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting CPU times: %v", err)
+	}
+	sortCPUTimes(perCPU)
+
 	// cpu usage
-	usageMetrics, err := c.collectCPUUsage(now)
+	usageMetrics, deltaMetrics, err := c.collectCPUUsage(perCPU, now)
 	if err != nil {
 		return nil, err
 	}
@@ -51,11 +106,7 @@ func (c *CPUCollector) Collect() ([]Metric, error) {
 	metrics = append(metrics, countMetrics...)
 
 	// cpu times
-	timeMetrics, err := c.collectCPUTimes(now)
-	if err != nil {
-		return nil, err
-	}
-	metrics = append(metrics, timeMetrics...)
+	metrics = append(metrics, c.collectCPUTimes(perCPU, now)...)
 
 	// system stats
 	systemMetrics, err := c.collectSystemStats(now)
@@ -64,30 +115,91 @@ func (c *CPUCollector) Collect() ([]Metric, error) {
 	}
 	metrics = append(metrics, systemMetrics...)
 
-	// store metrics in history
-	// TODO: trend analysis
-	c.storeInHistory(metrics)
+	// usage trends over history, only from real deltas
+	metrics = append(metrics, c.analyzeTrends(deltaMetrics, now)...)
 
 	return metrics, nil
 }
 
-func (c *CPUCollector) collectCPUUsage(now time.Time) ([]Metric, error) {
-	percentages, err := cpu.Percent(time.Second, true)
+// utilization since the previous Collect, derived from cpu time deltas so
+// collection never blocks; the first call reports averages since boot. the
+// second slice holds only the metrics computed against a previous sample
+func (c *CPUCollector) collectCPUUsage(perCPU []cpu.TimesStat, now time.Time) ([]Metric, []Metric, error) {
+	total, err := cpu.Times(false)
 	if err != nil {
-		return nil, fmt.Errorf("error collecting CPU usage: %v", err)
+		return nil, nil, fmt.Errorf("error collecting total CPU usage: %v", err)
+	}
+
+	samples := perCPU
+	if len(total) > 0 {
+		total[0].CPU = "total"
+		samples = append(append([]cpu.TimesStat{}, perCPU...), total[0])
 	}
 
 	metrics := []Metric{}
-	for i, usage := range percentages {
-		metrics = append(metrics, Metric{
+	deltas := []Metric{}
+	currentTimes := make(map[string]cpu.TimesStat, len(samples))
+
+	for _, times := range samples {
+		last, ok := c.lastTimes[times.CPU]
+		usage := cpuUsageMetrics(times.CPU, times, last, now)
+		metrics = append(metrics, usage...)
+		if ok {
+			deltas = append(deltas, usage...)
+		}
+		currentTimes[times.CPU] = times
+	}
+
+	c.lastTimes = currentTimes
+
+	return metrics, deltas, nil
+}
+
+// busy percentage and per-mode percentages between two cpu time samples
+func cpuUsageMetrics(name string, current, last cpu.TimesStat, now time.Time) []Metric {
+	elapsed := current.Total() - last.Total()
+	if elapsed <= 0 {
+		return nil
+	}
+
+	modes := []struct {
+		mode  string
+		delta float64
+	}{
+		{"user", current.User - last.User},
+		{"nice", current.Nice - last.Nice},
+		{"system", current.System - last.System},
+		{"idle", current.Idle - last.Idle},
+		{"iowait", current.Iowait - last.Iowait},
+		{"irq", current.Irq - last.Irq},
+		{"softirq", current.Softirq - last.Softirq},
+		{"steal", current.Steal - last.Steal},
+		{"guest", current.Guest - last.Guest},
+		{"guest_nice", current.GuestNice - last.GuestNice},
+	}
+
+	idle := (current.Idle - last.Idle) + (current.Iowait - last.Iowait)
+	usage := math.Max(0, math.Min(100, (elapsed-idle)/elapsed*100))
+
+	metrics := []Metric{
+		{
 			Name:      "cpu_usage",
 			Value:     usage,
 			Timestamp: now,
-			Labels:    map[string]string{"cpu": fmt.Sprintf("cpu%d", i)},
+			Labels:    map[string]string{"cpu": name},
+		},
+	}
+
+	for _, m := range modes {
+		metrics = append(metrics, Metric{
+			Name:      "cpu_mode_percent",
+			Value:     math.Max(0, m.delta/elapsed*100),
+			Timestamp: now,
+			Labels:    map[string]string{"cpu": name, "mode": m.mode},
 		})
 	}
 
-	return metrics, nil
+	return metrics
 }
 
 func (c *CPUCollector) collectLoadAverages(now time.Time) ([]Metric, error) {
@@ -158,20 +270,8 @@ func (c *CPUCollector) collectCPUCounts(now time.Time) ([]Metric, error) {
 	return metrics, nil
 }
 
-func (c *CPUCollector) collectCPUTimes(now time.Time) ([]Metric, error) {
-	times, err := cpu.Times(true)
-	if err != nil {
-		return nil, fmt.Errorf("error collecting CPU times: %v", err)
-	}
-
-	// Sort times by extracting the numeric core index from the CPU field
-	sort.Slice(times, func(i, j int) bool {
-		// Remove "cpu" prefix and parse as integers
-		cpuIndexI, _ := strconv.Atoi(strings.TrimPrefix(times[i].CPU, "cpu"))
-		cpuIndexJ, _ := strconv.Atoi(strings.TrimPrefix(times[j].CPU, "cpu"))
-		return cpuIndexI < cpuIndexJ
-	})
-
+// cumulative seconds per mode, from the sorted per-cpu sample
+func (c *CPUCollector) collectCPUTimes(times []cpu.TimesStat, now time.Time) []Metric {
 	metrics := []Metric{}
 	for _, cpuTime := range times {
 		cpuLabels := map[string]string{"cpu": cpuTime.CPU}
@@ -212,47 +312,133 @@ func (c *CPUCollector) collectCPUTimes(now time.Time) ([]Metric, error) {
 		})
 	}
 
-	return metrics, nil
+	return metrics
 }
 
-func getSystemStats() (uint64, uint64, error) {
-	_, _, _, err := host.PlatformInformation()
-	if err != nil {
-		return 0, 0, err
-	}
+// Sort times by extracting the numeric core index from the CPU field
+func sortCPUTimes(times []cpu.TimesStat) {
+	sort.Slice(times, func(i, j int) bool {
+		// Remove "cpu" prefix and parse as integers
+		cpuIndexI, _ := strconv.Atoi(strings.TrimPrefix(times[i].CPU, "cpu"))
+		cpuIndexJ, _ := strconv.Atoi(strings.TrimPrefix(times[j].CPU, "cpu"))
+		return cpuIndexI < cpuIndexJ
+	})
+}
+
+// counters from /proc/stat
+type procStat struct {
+	contextSwitches uint64
+	interrupts      uint64
+	forks           uint64
+	procsRunning    uint64
+	procsBlocked    uint64
+}
 
-	cpuStats, err := cpu.Times(false)
+func readProcStat(procPath string) (procStat, error) {
+	stat := procStat{}
+
+	file, err := os.Open(filepath.Join(procPath, "stat"))
 	if err != nil {
-		return 0, 0, err
+		return stat, err
 	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // intr lines are long
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
 
-	// Note: The actual values might need adjustment based on your OS
-	// These are approximations based on CPU statistics
-	contextSwitches := uint64(cpuStats[0].Irq + cpuStats[0].Softirq)
-	interrupts := uint64(cpuStats[0].Irq)
+		switch fields[0] {
+		case "ctxt":
+			stat.contextSwitches = value
+		case "intr":
+			stat.interrupts = value
+		case "processes":
+			stat.forks = value
+		case "procs_running":
+			stat.procsRunning = value
+		case "procs_blocked":
+			stat.procsBlocked = value
+		}
+	}
 
-	return contextSwitches, interrupts, nil
+	return stat, scanner.Err()
 }
 
 func (c *CPUCollector) collectSystemStats(now time.Time) ([]Metric, error) {
-	contextSwitches, interrupts, err := getSystemStats()
+	metrics := []Metric{}
+
+	stat, err := readProcStat(c.procPath)
 	if err != nil {
-		return nil, fmt.Errorf("error collecting context switches: %v", err)
-	}
+		fmt.Printf("Warning: error reading %s: %v\n", filepath.Join(c.procPath, "stat"), err)
+	} else {
+		metrics = append(metrics, []Metric{
+			{
+				Name:      "cpu_context_switches_total",
+				Value:     float64(stat.contextSwitches),
+				Timestamp: now,
+				Labels:    map[string]string{},
+			},
+			{
+				Name:      "cpu_interrupts_total",
+				Value:     float64(stat.interrupts),
+				Timestamp: now,
+				Labels:    map[string]string{},
+			},
+			{
+				Name:      "system_forks_total",
+				Value:     float64(stat.forks),
+				Timestamp: now,
+				Labels:    map[string]string{},
+			},
+			{
+				Name:      "system_procs_running",
+				Value:     float64(stat.procsRunning),
+				Timestamp: now,
+				Labels:    map[string]string{},
+			},
+			{
+				Name:      "system_procs_blocked",
+				Value:     float64(stat.procsBlocked),
+				Timestamp: now,
+				Labels:    map[string]string{},
+			},
+		}...)
+
+		timeSinceLastStat := now.Sub(c.lastStatCollect).Seconds()
+		if !c.lastStatCollect.IsZero() && timeSinceLastStat > 0 {
+			metrics = append(metrics, []Metric{
+				{
+					Name:      "cpu_context_switches_per_second",
+					Value:     counterRate(stat.contextSwitches, c.lastStat.contextSwitches, timeSinceLastStat),
+					Timestamp: now,
+					Labels:    map[string]string{},
+				},
+				{
+					Name:      "cpu_interrupts_per_second",
+					Value:     counterRate(stat.interrupts, c.lastStat.interrupts, timeSinceLastStat),
+					Timestamp: now,
+					Labels:    map[string]string{},
+				},
+				{
+					Name:      "system_forks_per_second",
+					Value:     counterRate(stat.forks, c.lastStat.forks, timeSinceLastStat),
+					Timestamp: now,
+					Labels:    map[string]string{},
+				},
+			}...)
+		}
 
-	metrics := []Metric{
-		{
-			Name:      "cpu_context_switches_total",
-			Value:     float64(contextSwitches),
-			Timestamp: now,
-			Labels:    map[string]string{},
-		},
-		{
-			Name:      "cpu_interrupts_total",
-			Value:     float64(interrupts),
-			Timestamp: now,
-			Labels:    map[string]string{},
-		},
+		c.lastStat = stat
+		c.lastStatCollect = now
 	}
 
 	bootTime, err := host.BootTime()
@@ -344,9 +530,75 @@ func (c *CPUCollector) collectSystemStats(now time.Time) ([]Metric, error) {
 	return metrics, nil
 }
 
-func (c *CPUCollector) storeInHistory(metrics []Metric) {
-	c.history = append(c.history, metrics...)
-	if len(c.history) > c.historySize {
-		c.history = c.history[len(c.history)-c.historySize:]
+// record usage in history and derive moving averages, rate of change and a
+// sustained-high flag per cpu
+func (c *CPUCollector) analyzeTrends(usageMetrics []Metric, now time.Time) []Metric {
+	metrics := []Metric{}
+
+	for _, usage := range usageMetrics {
+		if usage.Name != "cpu_usage" {
+			continue
+		}
+
+		buffer := c.history.add(usage)
+		cpuName := usage.Labels["cpu"]
+
+		for _, window := range c.trendWindows {
+			samples := buffer.since(now.Add(-window))
+			if len(samples) == 0 {
+				continue
+			}
+			windowLabels := map[string]string{"cpu": cpuName, "window": formatWindow(window)}
+
+			sum := 0.0
+			for _, s := range samples {
+				sum += s.value
+			}
+			metrics = append(metrics, Metric{
+				Name:      "cpu_usage_moving_average",
+				Value:     sum / float64(len(samples)),
+				Timestamp: now,
+				Labels:    windowLabels,
+			})
+
+			// percentage points per second between the first and last sample
+			first, last := samples[0], samples[len(samples)-1]
+			if elapsed := last.timestamp.Sub(first.timestamp).Seconds(); elapsed > 0 {
+				metrics = append(metrics, Metric{
+					Name:      "cpu_usage_rate_of_change",
+					Value:     (last.value - first.value) / elapsed,
+					Timestamp: now,
+					Labels:    windowLabels,
+				})
+			}
+		}
+
+		metrics = append(metrics, Metric{
+			Name:      "cpu_usage_sustained_high",
+			Value:     c.sustainedHigh(buffer, now),
+			Timestamp: now,
+			Labels:    map[string]string{"cpu": cpuName, "window": formatWindow(c.sustainedWindow)},
+		})
+	}
+
+	return metrics
+}
+
+// 1 when history covers the whole sustained window and every sample in it is
+// at or above the threshold, otherwise 0
+func (c *CPUCollector) sustainedHigh(buffer *ringBuffer, now time.Time) float64 {
+	windowStart := now.Add(-c.sustainedWindow)
+
+	oldest, ok := buffer.oldest()
+	if !ok || oldest.timestamp.After(windowStart) {
+		return 0
+	}
+
+	for _, s := range buffer.since(windowStart) {
+		if s.value < c.sustainedThreshold {
+			return 0
+		}
 	}
+
+	return 1
 }
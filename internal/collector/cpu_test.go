@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a /proc/stat with an intr line longer than the scanner's initial buffer
+func procStatFixture(ctxt, intr, processes uint64) string {
+	counts := make([]string, 40000)
+	for i := range counts {
+		counts[i] = "0"
+	}
+
+	return "cpu  100 0 50 1000 10 0 5 0 0 0\n" +
+		"cpu0 100 0 50 1000 10 0 5 0 0 0\n" +
+		fmt.Sprintf("intr %d %s\n", intr, strings.Join(counts, " ")) +
+		fmt.Sprintf("ctxt %d\n", ctxt) +
+		"btime 1700000000\n" +
+		fmt.Sprintf("processes %d\n", processes) +
+		"procs_running 3\n" +
+		"procs_blocked 1\n" +
+		"softirq 500 0 100 0 0 0 0 0 0 0 400\n"
+}
+
+func TestReadProcStat(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{"stat": procStatFixture(5000, 2000, 300)})
+
+	stat, err := readProcStat(root)
+	if err != nil {
+		t.Fatalf("readProcStat: %v", err)
+	}
+
+	expected := procStat{
+		contextSwitches: 5000,
+		interrupts:      2000,
+		forks:           300,
+		procsRunning:    3,
+		procsBlocked:    1,
+	}
+	if stat != expected {
+		t.Errorf("readProcStat = %+v, want %+v", stat, expected)
+	}
+}
+
+func TestCPUSystemStatsRates(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, map[string]string{"stat": procStatFixture(5000, 2000, 300)})
+
+	c := CreateCPUCollector(defaultCPUHistorySize)
+	c.procPath = root
+
+	now := time.Now()
+	first, err := c.collectSystemStats(now)
+	if err != nil {
+		t.Fatalf("collectSystemStats: %v", err)
+	}
+	for _, m := range first {
+		if strings.HasSuffix(m.Name, "_per_second") {
+			t.Errorf("unexpected %s on the first sample", m.Name)
+		}
+	}
+
+	writeFixture(t, root, map[string]string{"stat": procStatFixture(7000, 2600, 310)})
+
+	second, err := c.collectSystemStats(now.Add(2 * time.Second))
+	if err != nil {
+		t.Fatalf("collectSystemStats: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, m := range second {
+		values[m.Name] = m.Value
+	}
+
+	expected := map[string]float64{
+		"cpu_context_switches_total":      7000,
+		"cpu_interrupts_total":            2600,
+		"system_forks_total":              310,
+		"system_procs_running":            3,
+		"system_procs_blocked":            1,
+		"cpu_context_switches_per_second": 1000,
+		"cpu_interrupts_per_second":       300,
+		"system_forks_per_second":         5,
+	}
+	for name, value := range expected {
+		got, ok := values[name]
+		if !ok {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		if got != value {
+			t.Errorf("%s = %v, want %v", name, got, value)
+		}
+	}
+}
+
+func TestCPUCollectorOptions(t *testing.T) {
+	tests := []struct {
+		opts Options
+		err  string
+	}{
+		{opts: Options{}},
+		{opts: Options{"history_size": 10, "trend_windows": []interface{}{"1m", "5m"}, "sustained_window": "30s"}},
+		{opts: Options{"trend_windows": "1m,5m"}},
+		{opts: Options{"history_size": -1}, err: "history_size"},
+		{opts: Options{"history_size": 0}, err: "history_size"},
+		{opts: Options{"trend_windows": []interface{}{"1m", "bogus"}}, err: "trend_windows"},
+		{opts: Options{"trend_windows": []interface{}{"-5m"}}, err: "trend_windows"},
+		{opts: Options{"sustained_window": "0s"}, err: "sustained_window"},
+		{opts: Options{"sustained_window": "soon"}, err: "sustained_window"},
+	}
+
+	for _, tt := range tests {
+		_, err := New("cpu", tt.opts)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("New(cpu, %v) = %v, want nil", tt.opts, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("New(cpu, %v) = %v, want error about %s", tt.opts, err, tt.err)
+		}
+	}
+}
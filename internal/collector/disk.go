@@ -9,57 +9,55 @@ import (
 )
 
 type DiskCollector struct {
+	includeFstypes     []string
+	excludeFstypes     []string
+	includeMountpoints []string
+	excludeMountpoints []string
+
 	lastStats   map[string]disk.IOCountersStat
 	lastCollect time.Time
 	mutex       sync.Mutex
 }
 
+// pseudo and virtual filesystems that carry no useful capacity
+var defaultExcludedFstypes = []string{
+	"autofs", "binfmt_misc", "bpf", "cgroup", "cgroup2", "configfs",
+	"debugfs", "devpts", "devtmpfs", "fusectl", "hugetlbfs", "mqueue",
+	"nsfs", "overlay", "proc", "pstore", "ramfs", "rpc_pipefs",
+	"securityfs", "squashfs", "sysfs", "tmpfs", "tracefs",
+}
+
+func init() {
+	Register("disk", true, []string{"include_fstypes", "exclude_fstypes", "include_mountpoints", "exclude_mountpoints"}, func(opts Options) (Collector, error) {
+		c := CreateDiskCollector()
+		c.includeFstypes = opts.Strings("include_fstypes", c.includeFstypes)
+		c.excludeFstypes = opts.Strings("exclude_fstypes", c.excludeFstypes)
+		c.includeMountpoints = opts.Strings("include_mountpoints", c.includeMountpoints)
+		c.excludeMountpoints = opts.Strings("exclude_mountpoints", c.excludeMountpoints)
+		return c, nil
+	})
+}
+
 func CreateDiskCollector() *DiskCollector {
 	return &DiskCollector{
-		lastStats: make(map[string]disk.IOCountersStat),
+		excludeFstypes: defaultExcludedFstypes,
+		lastStats:      make(map[string]disk.IOCountersStat),
 	}
 }
 
+func (c *DiskCollector) Name() string {
+	return "disk"
+}
+
 func (c *DiskCollector) Collect() ([]Metric, error) {
 	metrics := []Metric{}
 	now := time.Now()
 
-	mainDiskMountPoint := "/"
-
-	usage, err := disk.Usage(mainDiskMountPoint)
+	fsMetrics, err := c.collectFilesystems(now)
 	if err != nil {
-		return nil, fmt.Errorf("error getting disk usage for main disk: %v", err)
+		return nil, err
 	}
-
-	metrics = append(metrics,
-		Metric{
-			Name:      "disk_usage",
-			Value:     usage.UsedPercent,
-			Timestamp: now,
-			Labels: map[string]string{
-				"mountpoint": mainDiskMountPoint,
-				"fstype":     usage.Fstype,
-			},
-		},
-		Metric{
-			Name:      "disk_total",
-			Value:     float64(usage.Total),
-			Timestamp: now,
-			Labels: map[string]string{
-				"mountpoint": mainDiskMountPoint,
-				"fstype":     usage.Fstype,
-			},
-		},
-		Metric{
-			Name:      "disk_free",
-			Value:     float64(usage.Free),
-			Timestamp: now,
-			Labels: map[string]string{
-				"mountpoint": mainDiskMountPoint,
-				"fstype":     usage.Fstype,
-			},
-		},
-	)
+	metrics = append(metrics, fsMetrics...)
 
 	ioStats, err := disk.IOCounters()
 	if err != nil {
@@ -74,7 +72,7 @@ func (c *DiskCollector) Collect() ([]Metric, error) {
 			ioLabels := map[string]string{"device": device}
 
 			if lastStat, exists := c.lastStats[device]; exists && timeSinceLastCollect > 0 {
-				readSpeed := float64(stats.ReadBytes-lastStat.ReadBytes) / timeSinceLastCollect
+				readSpeed := counterRate(stats.ReadBytes, lastStat.ReadBytes, timeSinceLastCollect)
 				metrics = append(metrics, Metric{
 					Name:      "disk_read_speed_bytes_per_second",
 					Value:     readSpeed,
@@ -82,7 +80,7 @@ func (c *DiskCollector) Collect() ([]Metric, error) {
 					Labels:    ioLabels,
 				})
 
-				writeSpeed := float64(stats.WriteBytes-lastStat.WriteBytes) / timeSinceLastCollect
+				writeSpeed := counterRate(stats.WriteBytes, lastStat.WriteBytes, timeSinceLastCollect)
 				metrics = append(metrics, Metric{
 					Name:      "disk_write_speed_bytes_per_second",
 					Value:     writeSpeed,
@@ -90,8 +88,8 @@ func (c *DiskCollector) Collect() ([]Metric, error) {
 					Labels:    ioLabels,
 				})
 
-				readIOPS := float64(stats.ReadCount-lastStat.ReadCount) / timeSinceLastCollect
-				writeIOPS := float64(stats.WriteCount-lastStat.WriteCount) / timeSinceLastCollect
+				readIOPS := counterRate(stats.ReadCount, lastStat.ReadCount, timeSinceLastCollect)
+				writeIOPS := counterRate(stats.WriteCount, lastStat.WriteCount, timeSinceLastCollect)
 
 				metrics = append(metrics, []Metric{
 					{
@@ -113,6 +111,8 @@ func (c *DiskCollector) Collect() ([]Metric, error) {
 						Labels:    ioLabels,
 					},
 				}...)
+
+				metrics = append(metrics, diskLatencyMetrics(stats, lastStat, timeSinceLastCollect, now, ioLabels)...)
 			}
 
 			metrics = append(metrics, []Metric{
@@ -155,3 +155,160 @@ func (c *DiskCollector) Collect() ([]Metric, error) {
 
 	return metrics, nil
 }
+
+// usage and inode metrics for every mounted filesystem that passes the filters
+func (c *DiskCollector) collectFilesystems(now time.Time) ([]Metric, error) {
+	partitions, err := disk.Partitions(true)
+	if err != nil {
+		return nil, fmt.Errorf("error listing disk partitions: %v", err)
+	}
+
+	metrics := []Metric{}
+	seen := make(map[string]bool)
+
+	for _, partition := range partitions {
+		if seen[partition.Mountpoint] || !c.includeFilesystem(partition) {
+			continue
+		}
+		seen[partition.Mountpoint] = true
+
+		usage, err := disk.Usage(partition.Mountpoint)
+		if err != nil {
+			fmt.Printf("Warning: error getting disk usage for %s: %v\n", partition.Mountpoint, err)
+			continue
+		}
+
+		// skip filesystems that report no capacity
+		if usage.Total == 0 {
+			continue
+		}
+
+		fsLabels := map[string]string{
+			"mountpoint": partition.Mountpoint,
+			"device":     partition.Device,
+			"fstype":     partition.Fstype,
+		}
+
+		metrics = append(metrics, []Metric{
+			{
+				Name:      "disk_usage",
+				Value:     usage.UsedPercent,
+				Timestamp: now,
+				Labels:    fsLabels,
+			},
+			{
+				Name:      "disk_total",
+				Value:     float64(usage.Total),
+				Timestamp: now,
+				Labels:    fsLabels,
+			},
+			{
+				Name:      "disk_used",
+				Value:     float64(usage.Used),
+				Timestamp: now,
+				Labels:    fsLabels,
+			},
+			{
+				Name:      "disk_free",
+				Value:     float64(usage.Free),
+				Timestamp: now,
+				Labels:    fsLabels,
+			},
+			{
+				Name:      "disk_inodes_total",
+				Value:     float64(usage.InodesTotal),
+				Timestamp: now,
+				Labels:    fsLabels,
+			},
+			{
+				Name:      "disk_inodes_used",
+				Value:     float64(usage.InodesUsed),
+				Timestamp: now,
+				Labels:    fsLabels,
+			},
+			{
+				Name:      "disk_inodes_free",
+				Value:     float64(usage.InodesFree),
+				Timestamp: now,
+				Labels:    fsLabels,
+			},
+			{
+				Name:      "disk_inodes_usage",
+				Value:     usage.InodesUsedPercent,
+				Timestamp: now,
+				Labels:    fsLabels,
+			},
+		}...)
+	}
+
+	return metrics, nil
+}
+
+// include lists (when set) must match, exclude lists must not
+func (c *DiskCollector) includeFilesystem(partition disk.PartitionStat) bool {
+	if len(c.includeFstypes) > 0 && !matchesAny(c.includeFstypes, partition.Fstype) {
+		return false
+	}
+	if matchesAny(c.excludeFstypes, partition.Fstype) {
+		return false
+	}
+	if len(c.includeMountpoints) > 0 && !matchesAny(c.includeMountpoints, partition.Mountpoint) {
+		return false
+	}
+	if matchesAny(c.excludeMountpoints, partition.Mountpoint) {
+		return false
+	}
+
+	return true
+}
+
+// await, utilization and queue depth from the time counters, which the
+// kernel reports in milliseconds
+func diskLatencyMetrics(stats, lastStat disk.IOCountersStat, seconds float64, now time.Time, labels map[string]string) []Metric {
+	elapsedMs := seconds * 1000
+	if elapsedMs <= 0 {
+		return nil
+	}
+
+	readAwait := 0.0
+	if reads := counterDelta(stats.ReadCount, lastStat.ReadCount); reads > 0 {
+		readAwait = counterDelta(stats.ReadTime, lastStat.ReadTime) / reads
+	}
+
+	writeAwait := 0.0
+	if writes := counterDelta(stats.WriteCount, lastStat.WriteCount); writes > 0 {
+		writeAwait = counterDelta(stats.WriteTime, lastStat.WriteTime) / writes
+	}
+
+	utilization := counterDelta(stats.IoTime, lastStat.IoTime) / elapsedMs * 100
+	if utilization > 100 {
+		utilization = 100
+	}
+
+	return []Metric{
+		{
+			Name:      "disk_read_await_milliseconds",
+			Value:     readAwait,
+			Timestamp: now,
+			Labels:    labels,
+		},
+		{
+			Name:      "disk_write_await_milliseconds",
+			Value:     writeAwait,
+			Timestamp: now,
+			Labels:    labels,
+		},
+		{
+			Name:      "disk_utilization_percent",
+			Value:     utilization,
+			Timestamp: now,
+			Labels:    labels,
+		},
+		{
+			Name:      "disk_queue_depth",
+			Value:     counterDelta(stats.WeightedIO, lastStat.WeightedIO) / elapsedMs,
+			Timestamp: now,
+			Labels:    labels,
+		},
+	}
+}
@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type sample struct {
+	value     float64
+	timestamp time.Time
+}
+
+// fixed-capacity ring buffer holding the most recent samples of one series
+type ringBuffer struct {
+	samples []sample
+	start   int
+	count   int
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{
+		samples: make([]sample, capacity),
+	}
+}
+
+// add a sample, overwriting the oldest once full
+func (r *ringBuffer) add(s sample) {
+	if len(r.samples) == 0 {
+		return
+	}
+
+	if r.count < len(r.samples) {
+		r.samples[(r.start+r.count)%len(r.samples)] = s
+		r.count++
+		return
+	}
+
+	r.samples[r.start] = s
+	r.start = (r.start + 1) % len(r.samples)
+}
+
+func (r *ringBuffer) oldest() (sample, bool) {
+	if r.count == 0 {
+		return sample{}, false
+	}
+
+	return r.samples[r.start], true
+}
+
+// samples taken at or after t, oldest first
+func (r *ringBuffer) since(t time.Time) []sample {
+	result := []sample{}
+	for i := 0; i < r.count; i++ {
+		s := r.samples[(r.start+i)%len(r.samples)]
+		if !s.timestamp.Before(t) {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+// ring buffers keyed by series, a metric name plus its labels
+type seriesHistory struct {
+	size   int
+	series map[string]*ringBuffer
+}
+
+func newSeriesHistory(size int) *seriesHistory {
+	return &seriesHistory{
+		size:   size,
+		series: make(map[string]*ringBuffer),
+	}
+}
+
+// record a metric and return the buffer of its series
+func (h *seriesHistory) add(metric Metric) *ringBuffer {
+	key := seriesKey(metric)
+
+	buffer, exists := h.series[key]
+	if !exists {
+		buffer = newRingBuffer(h.size)
+		h.series[key] = buffer
+	}
+	buffer.add(sample{value: metric.Value, timestamp: metric.Timestamp})
+
+	return buffer
+}
+
+func seriesKey(metric Metric) string {
+	keys := make([]string, 0, len(metric.Labels))
+	for k := range metric.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(metric.Name)
+	for _, k := range keys {
+		fmt.Fprintf(&b, ",%s=%s", k, metric.Labels[k])
+	}
+
+	return b.String()
+}
+
+// short label for a window, e.g. "30s", "5m", "1h"
+func formatWindow(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
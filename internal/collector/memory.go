@@ -2,15 +2,45 @@ package collector
 
 import (
 	"fmt"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/mem"
 )
 
-type MemoryCollector struct{}
+type MemoryCollector struct {
+	procPath string
+
+	lastVmstat      map[string]uint64
+	lastCollect     time.Time
+	lastSwap        *mem.SwapMemoryStat
+	lastSwapCollect time.Time
+	mutex           sync.Mutex
+}
+
+// page reclaim counters in /proc/vmstat are split by reclaimer
+var (
+	pageScanCounters  = []string{"pgscan_kswapd", "pgscan_direct", "pgscan_khugepaged", "pgscan_proactive"}
+	pageStealCounters = []string{"pgsteal_kswapd", "pgsteal_direct", "pgsteal_khugepaged", "pgsteal_proactive"}
+)
+
+func init() {
+	Register("memory", true, []string{"proc_path"}, func(opts Options) (Collector, error) {
+		c := CreateMemoryCollector()
+		c.procPath = opts.String("proc_path", c.procPath)
+		return c, nil
+	})
+}
 
 func CreateMemoryCollector() *MemoryCollector {
-	return &MemoryCollector{}
+	return &MemoryCollector{
+		procPath: "/proc",
+	}
+}
+
+func (c *MemoryCollector) Name() string {
+	return "memory"
 }
 
 func (c *MemoryCollector) Collect() ([]Metric, error) {
@@ -47,6 +77,18 @@ func (c *MemoryCollector) Collect() ([]Metric, error) {
 			Timestamp: now,
 			Labels:    map[string]string{"type": "virtual"},
 		},
+		Metric{
+			Name:      "memory_cached",
+			Value:     float64(vmem.Cached),
+			Timestamp: now,
+			Labels:    map[string]string{"type": "virtual"},
+		},
+		Metric{
+			Name:      "memory_available",
+			Value:     float64(vmem.Available),
+			Timestamp: now,
+			Labels:    map[string]string{"type": "virtual"},
+		},
 	)
 
 	metrics = append(metrics, []Metric{
@@ -94,6 +136,57 @@ func (c *MemoryCollector) Collect() ([]Metric, error) {
 		},
 	}...)
 
+	metrics = append(metrics, []Metric{
+		{
+			Name:      "memory_committed_bytes",
+			Value:     float64(vmem.CommittedAS),
+			Timestamp: now,
+			Labels:    map[string]string{"type": "virtual"},
+		},
+		{
+			Name:      "memory_commit_limit_bytes",
+			Value:     float64(vmem.CommitLimit),
+			Timestamp: now,
+			Labels:    map[string]string{"type": "virtual"},
+		},
+		{
+			Name:      "memory_hugepages_total",
+			Value:     float64(vmem.HugePagesTotal),
+			Timestamp: now,
+			Labels:    map[string]string{"type": "hugepages"},
+		},
+		{
+			Name:      "memory_hugepages_free",
+			Value:     float64(vmem.HugePagesFree),
+			Timestamp: now,
+			Labels:    map[string]string{"type": "hugepages"},
+		},
+		{
+			Name:      "memory_hugepages_reserved",
+			Value:     float64(vmem.HugePagesRsvd),
+			Timestamp: now,
+			Labels:    map[string]string{"type": "hugepages"},
+		},
+		{
+			Name:      "memory_hugepages_surplus",
+			Value:     float64(vmem.HugePagesSurp),
+			Timestamp: now,
+			Labels:    map[string]string{"type": "hugepages"},
+		},
+		{
+			Name:      "memory_hugepage_size_bytes",
+			Value:     float64(vmem.HugePageSize),
+			Timestamp: now,
+			Labels:    map[string]string{"type": "hugepages"},
+		},
+	}...)
+
+	vmstatMetrics, err := c.collectVmstat(now)
+	if err != nil {
+		fmt.Printf("Warning: error reading %s: %v\n", filepath.Join(c.procPath, "vmstat"), err)
+	}
+	metrics = append(metrics, vmstatMetrics...)
+
 	swap, err := mem.SwapMemory()
 	if err == nil {
 		metrics = append(metrics, []Metric{
@@ -134,7 +227,94 @@ func (c *MemoryCollector) Collect() ([]Metric, error) {
 				Labels:    map[string]string{"type": "swap"},
 			},
 		}...)
+
+		c.mutex.Lock()
+		timeSinceLastSwap := now.Sub(c.lastSwapCollect).Seconds()
+		if c.lastSwap != nil && timeSinceLastSwap > 0 {
+			metrics = append(metrics, []Metric{
+				{
+					Name:      "swap_in_bytes_per_second",
+					Value:     counterRate(swap.Sin, c.lastSwap.Sin, timeSinceLastSwap),
+					Timestamp: now,
+					Labels:    map[string]string{"type": "swap"},
+				},
+				{
+					Name:      "swap_out_bytes_per_second",
+					Value:     counterRate(swap.Sout, c.lastSwap.Sout, timeSinceLastSwap),
+					Timestamp: now,
+					Labels:    map[string]string{"type": "swap"},
+				},
+			}...)
+		}
+		c.lastSwap = swap
+		c.lastSwapCollect = now
+		c.mutex.Unlock()
 	}
 
 	return metrics, nil
 }
+
+// page faults, oom kills and reclaim activity from /proc/vmstat
+func (c *MemoryCollector) collectVmstat(now time.Time) ([]Metric, error) {
+	vmstat, err := readKeyValueFile(filepath.Join(c.procPath, "vmstat"))
+	if err != nil {
+		return nil, err
+	}
+
+	// pgfault counts every fault, major ones included
+	vmstat["pgminfault"] = vmstat["pgfault"] - vmstat["pgmajfault"]
+	vmstat["pgscan"] = sumCounters(vmstat, pageScanCounters)
+	vmstat["pgsteal"] = sumCounters(vmstat, pageStealCounters)
+
+	vmstatLabels := map[string]string{"type": "vmstat"}
+
+	counters := []struct {
+		key  string
+		name string
+		rate string
+	}{
+		{"pgmajfault", "memory_page_faults_major_total", "memory_page_faults_major_per_second"},
+		{"pgminfault", "memory_page_faults_minor_total", "memory_page_faults_minor_per_second"},
+		{"pgscan", "memory_pages_scanned_total", "memory_pages_scanned_per_second"},
+		{"pgsteal", "memory_pages_reclaimed_total", "memory_pages_reclaimed_per_second"},
+		{"oom_kill", "memory_oom_kills_total", ""},
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timeSinceLastCollect := now.Sub(c.lastCollect).Seconds()
+
+	metrics := []Metric{}
+	for _, counter := range counters {
+		metrics = append(metrics, Metric{
+			Name:      counter.name,
+			Value:     float64(vmstat[counter.key]),
+			Timestamp: now,
+			Labels:    vmstatLabels,
+		})
+
+		if counter.rate != "" && c.lastVmstat != nil && timeSinceLastCollect > 0 {
+			metrics = append(metrics, Metric{
+				Name:      counter.rate,
+				Value:     counterRate(vmstat[counter.key], c.lastVmstat[counter.key], timeSinceLastCollect),
+				Timestamp: now,
+				Labels:    vmstatLabels,
+			})
+		}
+	}
+
+	c.lastVmstat = vmstat
+	c.lastCollect = now
+
+	return metrics, nil
+}
+
+func sumCounters(values map[string]uint64, keys []string) uint64 {
+	var total uint64
+	for _, key := range keys {
+		total += values[key]
+	}
+
+	return total
+}
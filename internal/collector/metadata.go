@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"strings"
+
+	"ddgo/protocol"
+)
+
+const (
+	MetricTypeGauge   = protocol.MetricTypeGauge
+	MetricTypeCounter = protocol.MetricTypeCounter
+)
+
+// names ending in _total that are sizes or counts rather than counters
+var totalGauges = map[string]bool{
+	"memory_total":           true,
+	"memory_hugepages_total": true,
+	"disk_total":             true,
+	"disk_inodes_total":      true,
+	"system_processes_total": true,
+	"system_threads_total":   true,
+}
+
+// names whose unit does not follow from their suffix
+var metricUnits = map[string]string{
+	"cpu_usage":                "percent",
+	"cpu_usage_moving_average": "percent",
+	"memory_usage":             "percent",
+	"disk_usage":               "percent",
+	"disk_inodes_usage":        "percent",
+	"pressure_avg10":           "percent",
+	"pressure_avg60":           "percent",
+	"pressure_avg300":          "percent",
+	"memory_total":             "bytes",
+	"memory_used":              "bytes",
+	"memory_free":              "bytes",
+	"memory_cached":            "bytes",
+	"memory_available":         "bytes",
+	"memory_page_tables":       "bytes",
+	"memory_mapped":            "bytes",
+	"memory_slab":              "bytes",
+	"memory_page_cache":        "bytes",
+	"memory_writeback_temp":    "bytes",
+	"memory_dirty_pages":       "bytes",
+	"memory_writeback_pages":   "bytes",
+	"swap_free":                "bytes",
+	"disk_total":               "bytes",
+	"disk_used":                "bytes",
+	"disk_free":                "bytes",
+	"disk_read_iops":           "per_second",
+	"disk_write_iops":          "per_second",
+	"disk_total_iops":          "per_second",
+}
+
+// unit suffixes, longest first
+var unitSuffixes = []struct {
+	suffix string
+	unit   string
+}{
+	{"_bytes_per_second", "bytes_per_second"},
+	{"_per_second", "per_second"},
+	{"_bytes", "bytes"},
+	{"_seconds", "seconds"},
+	{"_milliseconds", "milliseconds"},
+	{"_percent", "percent"},
+	{"_celsius", "celsius"},
+	{"_volts", "volts"},
+	{"_rpm", "rpm"},
+}
+
+// fill in the type and unit of metrics that do not set them, following the
+// naming conventions used by the collectors
+func Annotate(metrics []Metric) {
+	for i := range metrics {
+		if metrics[i].Type == "" {
+			metrics[i].Type = metricType(metrics[i].Name)
+		}
+		if metrics[i].Unit == "" {
+			metrics[i].Unit = metricUnit(metrics[i].Name)
+		}
+	}
+}
+
+func metricType(name string) string {
+	// cumulative cpu seconds since boot
+	if strings.HasPrefix(name, "cpu_time_") {
+		return MetricTypeCounter
+	}
+
+	if strings.HasSuffix(name, "_total") && !totalGauges[name] {
+		return MetricTypeCounter
+	}
+
+	return MetricTypeGauge
+}
+
+func metricUnit(name string) string {
+	if unit, ok := metricUnits[name]; ok {
+		return unit
+	}
+
+	if strings.HasPrefix(name, "cpu_time_") {
+		return "seconds"
+	}
+
+	base := strings.TrimSuffix(name, "_total")
+	for _, s := range unitSuffixes {
+		if strings.HasSuffix(base, s.suffix) {
+			return s.unit
+		}
+	}
+
+	return ""
+}
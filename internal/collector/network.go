@@ -0,0 +1,221 @@
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+type NetworkCollector struct {
+	includeLoopback bool
+	includeVirtual  bool
+	exclude         []string
+	sysPath         string
+
+	lastStats   map[string]net.IOCountersStat
+	lastCollect time.Time
+	mutex       sync.Mutex
+}
+
+func init() {
+	Register("network", true, []string{"include_loopback", "include_virtual", "exclude", "sys_path"}, func(opts Options) (Collector, error) {
+		c := CreateNetworkCollector(
+			opts.Bool("include_loopback", false),
+			opts.Bool("include_virtual", false),
+			opts.Strings("exclude", nil),
+		)
+		c.sysPath = opts.String("sys_path", c.sysPath)
+		return c, nil
+	})
+}
+
+// exclude holds interface name globs (e.g. "veth*") that are always skipped
+func CreateNetworkCollector(includeLoopback, includeVirtual bool, exclude []string) *NetworkCollector {
+	return &NetworkCollector{
+		includeLoopback: includeLoopback,
+		includeVirtual:  includeVirtual,
+		exclude:         exclude,
+		sysPath:         "/sys",
+		lastStats:       make(map[string]net.IOCountersStat),
+	}
+}
+
+func (c *NetworkCollector) Name() string {
+	return "network"
+}
+
+func (c *NetworkCollector) Collect() ([]Metric, error) {
+	metrics := []Metric{}
+	now := time.Now()
+
+	ioStats, err := net.IOCounters(true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting network IO statistics: %v", err)
+	}
+
+	loopback := make(map[string]bool)
+	if interfaces, err := net.Interfaces(); err == nil {
+		for _, iface := range interfaces {
+			for _, flag := range iface.Flags {
+				if flag == "loopback" {
+					loopback[iface.Name] = true
+				}
+			}
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timeSinceLastCollect := now.Sub(c.lastCollect).Seconds()
+	currentStats := make(map[string]net.IOCountersStat)
+
+	for _, stats := range ioStats {
+		if c.skipInterface(stats.Name, loopback[stats.Name]) {
+			continue
+		}
+		currentStats[stats.Name] = stats
+
+		ifaceLabels := map[string]string{"interface": stats.Name}
+
+		if lastStat, exists := c.lastStats[stats.Name]; exists && timeSinceLastCollect > 0 {
+			metrics = append(metrics, []Metric{
+				{
+					Name:      "network_receive_bytes_per_second",
+					Value:     counterRate(stats.BytesRecv, lastStat.BytesRecv, timeSinceLastCollect),
+					Timestamp: now,
+					Labels:    ifaceLabels,
+				},
+				{
+					Name:      "network_transmit_bytes_per_second",
+					Value:     counterRate(stats.BytesSent, lastStat.BytesSent, timeSinceLastCollect),
+					Timestamp: now,
+					Labels:    ifaceLabels,
+				},
+				{
+					Name:      "network_receive_packets_per_second",
+					Value:     counterRate(stats.PacketsRecv, lastStat.PacketsRecv, timeSinceLastCollect),
+					Timestamp: now,
+					Labels:    ifaceLabels,
+				},
+				{
+					Name:      "network_transmit_packets_per_second",
+					Value:     counterRate(stats.PacketsSent, lastStat.PacketsSent, timeSinceLastCollect),
+					Timestamp: now,
+					Labels:    ifaceLabels,
+				},
+				{
+					Name:      "network_receive_errors_per_second",
+					Value:     counterRate(stats.Errin, lastStat.Errin, timeSinceLastCollect),
+					Timestamp: now,
+					Labels:    ifaceLabels,
+				},
+				{
+					Name:      "network_transmit_errors_per_second",
+					Value:     counterRate(stats.Errout, lastStat.Errout, timeSinceLastCollect),
+					Timestamp: now,
+					Labels:    ifaceLabels,
+				},
+				{
+					Name:      "network_receive_drops_per_second",
+					Value:     counterRate(stats.Dropin, lastStat.Dropin, timeSinceLastCollect),
+					Timestamp: now,
+					Labels:    ifaceLabels,
+				},
+				{
+					Name:      "network_transmit_drops_per_second",
+					Value:     counterRate(stats.Dropout, lastStat.Dropout, timeSinceLastCollect),
+					Timestamp: now,
+					Labels:    ifaceLabels,
+				},
+			}...)
+		}
+
+		metrics = append(metrics, []Metric{
+			{
+				Name:      "network_receive_bytes_total",
+				Value:     float64(stats.BytesRecv),
+				Timestamp: now,
+				Labels:    ifaceLabels,
+			},
+			{
+				Name:      "network_transmit_bytes_total",
+				Value:     float64(stats.BytesSent),
+				Timestamp: now,
+				Labels:    ifaceLabels,
+			},
+			{
+				Name:      "network_receive_packets_total",
+				Value:     float64(stats.PacketsRecv),
+				Timestamp: now,
+				Labels:    ifaceLabels,
+			},
+			{
+				Name:      "network_transmit_packets_total",
+				Value:     float64(stats.PacketsSent),
+				Timestamp: now,
+				Labels:    ifaceLabels,
+			},
+			{
+				Name:      "network_receive_errors_total",
+				Value:     float64(stats.Errin),
+				Timestamp: now,
+				Labels:    ifaceLabels,
+			},
+			{
+				Name:      "network_transmit_errors_total",
+				Value:     float64(stats.Errout),
+				Timestamp: now,
+				Labels:    ifaceLabels,
+			},
+			{
+				Name:      "network_receive_drops_total",
+				Value:     float64(stats.Dropin),
+				Timestamp: now,
+				Labels:    ifaceLabels,
+			},
+			{
+				Name:      "network_transmit_drops_total",
+				Value:     float64(stats.Dropout),
+				Timestamp: now,
+				Labels:    ifaceLabels,
+			},
+		}...)
+	}
+
+	c.lastStats = currentStats
+	c.lastCollect = now
+
+	return metrics, nil
+}
+
+func (c *NetworkCollector) skipInterface(name string, isLoopback bool) bool {
+	if matchesAny(c.exclude, name) {
+		return true
+	}
+
+	if isLoopback && !c.includeLoopback {
+		return true
+	}
+
+	if !c.includeVirtual && !isLoopback && c.isVirtual(name) {
+		return true
+	}
+
+	return false
+}
+
+// linux links virtual interfaces (veth, bridges, tun/tap, ...) under
+// /sys/devices/virtual/net
+func (c *NetworkCollector) isVirtual(name string) bool {
+	target, err := filepath.EvalSymlinks(filepath.Join(c.sysPath, "class", "net", name))
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(filepath.ToSlash(target), "/devices/virtual/")
+}
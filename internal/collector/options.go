@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// per-collector settings, keyed by option name
+type Options map[string]interface{}
+
+func (o Options) String(key string, def string) string {
+	value, ok := o[key]
+	if !ok || value == nil {
+		return def
+	}
+
+	return fmt.Sprint(value)
+}
+
+func (o Options) Int(key string, def int) int {
+	switch value := o[key].(type) {
+	case int:
+		return value
+	case int64:
+		return int(value)
+	case uint64:
+		return int(value)
+	case float64:
+		return int(value)
+	case string:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+
+	return def
+}
+
+func (o Options) Float(key string, def float64) float64 {
+	switch value := o[key].(type) {
+	case float64:
+		return value
+	case int:
+		return float64(value)
+	case int64:
+		return float64(value)
+	case uint64:
+		return float64(value)
+	case string:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+
+	return def
+}
+
+func (o Options) Bool(key string, def bool) bool {
+	switch value := o[key].(type) {
+	case bool:
+		return value
+	case string:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return def
+}
+
+// accepts a list or a comma-separated string
+func (o Options) Strings(key string, def []string) []string {
+	switch value := o[key].(type) {
+	case []string:
+		return value
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			values = append(values, fmt.Sprint(v))
+		}
+		return values
+	case string:
+		values := []string{}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+
+	return def
+}
+
+// accepts a duration string ("30s") or a number of seconds
+func (o Options) Duration(key string, def time.Duration) time.Duration {
+	switch value := o[key].(type) {
+	case time.Duration:
+		return value
+	case int:
+		return time.Duration(value) * time.Second
+	case int64:
+		return time.Duration(value) * time.Second
+	case float64:
+		return time.Duration(value * float64(time.Second))
+	case string:
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+
+	return def
+}
+
+// accepts a list or a comma-separated string of durations
+func (o Options) Durations(key string, def []time.Duration) []time.Duration {
+	items, ok := o[key].([]interface{})
+	if !ok {
+		values := o.Strings(key, nil)
+		if values == nil {
+			return def
+		}
+		for _, value := range values {
+			items = append(items, value)
+		}
+	}
+
+	durations := make([]time.Duration, 0, len(items))
+	for _, item := range items {
+		if d := (Options{key: item}).Duration(key, 0); d > 0 {
+			durations = append(durations, d)
+		}
+	}
+
+	return durations
+}
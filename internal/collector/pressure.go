@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// pressure stall information (PSI), available on linux 4.20+ kernels built
+// with CONFIG_PSI
+type PressureCollector struct {
+	procPath string
+}
+
+var pressureResources = []string{"cpu", "memory", "io"}
+
+func init() {
+	Register("pressure", true, []string{"proc_path"}, func(opts Options) (Collector, error) {
+		c := CreatePressureCollector()
+		c.procPath = opts.String("proc_path", c.procPath)
+		return c, nil
+	})
+}
+
+func CreatePressureCollector() *PressureCollector {
+	return &PressureCollector{
+		procPath: "/proc",
+	}
+}
+
+func (c *PressureCollector) Name() string {
+	return "pressure"
+}
+
+func (c *PressureCollector) Collect() ([]Metric, error) {
+	metrics := []Metric{}
+	now := time.Now()
+
+	supported := 1.0
+	for _, resource := range pressureResources {
+		path := filepath.Join(c.procPath, "pressure", resource)
+
+		resourceMetrics, err := readPressureFile(path, resource, now)
+		if os.IsNotExist(err) || errors.Is(err, syscall.EOPNOTSUPP) {
+			// kernels without PSI have no /proc/pressure, and psi=0 makes
+			// reads fail with EOPNOTSUPP
+			supported = 0
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		}
+		metrics = append(metrics, resourceMetrics...)
+	}
+
+	if supported == 0 {
+		metrics = []Metric{}
+	}
+
+	metrics = append(metrics, Metric{
+		Name:      "pressure_supported",
+		Value:     supported,
+		Timestamp: now,
+		Labels:    map[string]string{},
+	})
+
+	return metrics, nil
+}
+
+// parses lines of the form
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readPressureFile(path, resource string, now time.Time) ([]Metric, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	metrics := []Metric{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		labels := map[string]string{"resource": resource, "kind": fields[0]}
+		for _, field := range fields[1:] {
+			key, raw, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for %s", raw, key)
+			}
+
+			switch key {
+			case "avg10", "avg60", "avg300":
+				metrics = append(metrics, Metric{
+					Name:      "pressure_" + key,
+					Value:     value,
+					Timestamp: now,
+					Labels:    labels,
+				})
+			case "total":
+				// microseconds of stall time
+				metrics = append(metrics, Metric{
+					Name:      "pressure_stall_seconds_total",
+					Value:     value / 1e6,
+					Timestamp: now,
+					Labels:    labels,
+				})
+			}
+		}
+	}
+
+	return metrics, scanner.Err()
+}
@@ -0,0 +1,216 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+type ProcessCollector struct {
+	topN             int
+	allowlist        []string
+	maxCmdlineLength int
+
+	lastCounters map[int32]processCounters
+	lastCollect  time.Time
+	mutex        sync.Mutex
+}
+
+// cumulative counters kept between collections to derive rates
+type processCounters struct {
+	createTime int64
+	cpuSeconds float64
+	readBytes  uint64
+	writeBytes uint64
+}
+
+type processSample struct {
+	proc       *process.Process
+	name       string
+	counters   processCounters
+	cpuPercent float64
+	rss        uint64
+	openFDs    int32
+	readRate   float64
+	writeRate  float64
+}
+
+func init() {
+	Register("process", true, []string{"top_n", "allowlist", "max_cmdline_length"}, func(opts Options) (Collector, error) {
+		c := CreateProcessCollector(opts.Int("top_n", 10), opts.Strings("allowlist", nil))
+		c.maxCmdlineLength = opts.Int("max_cmdline_length", c.maxCmdlineLength)
+		return c, nil
+	})
+}
+
+// topN processes are reported per ranking (cpu, rss, fds, io); processes
+// whose name matches an allowlist glob are always reported
+func CreateProcessCollector(topN int, allowlist []string) *ProcessCollector {
+	return &ProcessCollector{
+		topN:             topN,
+		allowlist:        allowlist,
+		maxCmdlineLength: 256,
+		lastCounters:     make(map[int32]processCounters),
+	}
+}
+
+func (c *ProcessCollector) Name() string {
+	return "process"
+}
+
+func (c *ProcessCollector) Collect() ([]Metric, error) {
+	now := time.Now()
+
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, fmt.Errorf("error listing processes: %v", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timeSinceLastCollect := now.Sub(c.lastCollect).Seconds()
+	currentCounters := make(map[int32]processCounters, len(procs))
+	samples := make([]processSample, 0, len(procs))
+
+	for _, p := range procs {
+		// processes that exit while we walk the list are skipped
+		times, err := p.Times()
+		if err != nil {
+			continue
+		}
+
+		sample := processSample{proc: p}
+		sample.name, _ = p.Name()
+		sample.counters.createTime, _ = p.CreateTime()
+		sample.counters.cpuSeconds = times.User + times.System
+
+		if memInfo, err := p.MemoryInfo(); err == nil {
+			sample.rss = memInfo.RSS
+		}
+		if fds, err := p.NumFDs(); err == nil {
+			sample.openFDs = fds
+		}
+		if io, err := p.IOCounters(); err == nil {
+			sample.counters.readBytes = io.ReadBytes
+			sample.counters.writeBytes = io.WriteBytes
+		}
+
+		last, exists := c.lastCounters[p.Pid]
+		if exists && last.createTime == sample.counters.createTime && timeSinceLastCollect > 0 {
+			if cpuDelta := sample.counters.cpuSeconds - last.cpuSeconds; cpuDelta > 0 {
+				sample.cpuPercent = cpuDelta / timeSinceLastCollect * 100
+			}
+			sample.readRate = counterRate(sample.counters.readBytes, last.readBytes, timeSinceLastCollect)
+			sample.writeRate = counterRate(sample.counters.writeBytes, last.writeBytes, timeSinceLastCollect)
+		}
+
+		currentCounters[p.Pid] = sample.counters
+		samples = append(samples, sample)
+	}
+
+	c.lastCounters = currentCounters
+	c.lastCollect = now
+
+	metrics := []Metric{}
+	for _, sample := range c.selectProcesses(samples) {
+		metrics = append(metrics, c.processMetrics(sample, now)...)
+	}
+
+	return metrics, nil
+}
+
+// union of the top N by each ranking plus allowlisted processes, highest
+// cpu first
+func (c *ProcessCollector) selectProcesses(samples []processSample) []processSample {
+	selected := make(map[int32]bool)
+
+	rankings := []func(a, b processSample) bool{
+		func(a, b processSample) bool { return a.cpuPercent > b.cpuPercent },
+		func(a, b processSample) bool { return a.rss > b.rss },
+		func(a, b processSample) bool { return a.openFDs > b.openFDs },
+		func(a, b processSample) bool { return a.readRate+a.writeRate > b.readRate+b.writeRate },
+	}
+
+	for _, ranksHigher := range rankings {
+		sort.SliceStable(samples, func(i, j int) bool { return ranksHigher(samples[i], samples[j]) })
+		for i := 0; i < c.topN && i < len(samples); i++ {
+			selected[samples[i].proc.Pid] = true
+		}
+	}
+
+	result := []processSample{}
+	for _, sample := range samples {
+		if selected[sample.proc.Pid] || matchesAny(c.allowlist, sample.name) {
+			result = append(result, sample)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].cpuPercent > result[j].cpuPercent })
+
+	return result
+}
+
+func (c *ProcessCollector) processMetrics(sample processSample, now time.Time) []Metric {
+	username, _ := sample.proc.Username()
+	cmdline, _ := sample.proc.Cmdline()
+	if c.maxCmdlineLength > 0 && len(cmdline) > c.maxCmdlineLength {
+		cmdline = cmdline[:c.maxCmdlineLength]
+	}
+
+	procLabels := map[string]string{
+		"pid":     strconv.Itoa(int(sample.proc.Pid)),
+		"name":    sample.name,
+		"user":    username,
+		"cmdline": cmdline,
+	}
+
+	return []Metric{
+		{
+			Name:      "process_cpu_percent",
+			Value:     sample.cpuPercent,
+			Timestamp: now,
+			Labels:    procLabels,
+		},
+		{
+			Name:      "process_memory_rss_bytes",
+			Value:     float64(sample.rss),
+			Timestamp: now,
+			Labels:    procLabels,
+		},
+		{
+			Name:      "process_open_fds",
+			Value:     float64(sample.openFDs),
+			Timestamp: now,
+			Labels:    procLabels,
+		},
+		{
+			Name:      "process_io_read_bytes_total",
+			Value:     float64(sample.counters.readBytes),
+			Timestamp: now,
+			Labels:    procLabels,
+		},
+		{
+			Name:      "process_io_write_bytes_total",
+			Value:     float64(sample.counters.writeBytes),
+			Timestamp: now,
+			Labels:    procLabels,
+		},
+		{
+			Name:      "process_io_read_bytes_per_second",
+			Value:     sample.readRate,
+			Timestamp: now,
+			Labels:    procLabels,
+		},
+		{
+			Name:      "process_io_write_bytes_per_second",
+			Value:     sample.writeRate,
+			Timestamp: now,
+			Labels:    procLabels,
+		},
+	}
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// source of metrics run by the agent on every tick
+type Collector interface {
+	Name() string
+	Collect() ([]Metric, error)
+}
+
+// builds a collector from its configured options
+type Factory func(opts Options) (Collector, error)
+
+type registration struct {
+	factory          Factory
+	enabledByDefault bool
+	options          []string // option keys the factory reads
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = make(map[string]registration)
+)
+
+// make a collector available under name, called from init. options lists
+// the option keys the factory understands
+func Register(name string, enabledByDefault bool, options []string, factory Factory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("collector %q registered twice", name))
+	}
+
+	registry[name] = registration{
+		factory:          factory,
+		enabledByDefault: enabledByDefault,
+		options:          options,
+	}
+}
+
+// names of all registered collectors, sorted
+func Names() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// names of collectors enabled when none are configured, sorted
+func DefaultNames() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	names := []string{}
+	for name, reg := range registry {
+		if reg.enabledByDefault {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// option keys understood by a registered collector, sorted
+func KnownOptions(name string) ([]string, error) {
+	registryMutex.RLock()
+	reg, exists := registry[name]
+	registryMutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown collector %q", name)
+	}
+
+	options := append([]string{}, reg.options...)
+	sort.Strings(options)
+
+	return options, nil
+}
+
+// create a single registered collector
+func New(name string, opts Options) (Collector, error) {
+	registryMutex.RLock()
+	reg, exists := registry[name]
+	registryMutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown collector %q", name)
+	}
+
+	if opts == nil {
+		opts = Options{}
+	}
+
+	c, err := reg.factory(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s collector: %v", name, err)
+	}
+
+	return c, nil
+}
+
+// create the named collectors in order, with options keyed by collector name
+func NewSet(names []string, options map[string]Options) ([]Collector, error) {
+	collectors := make([]Collector, 0, len(names))
+	seen := make(map[string]bool)
+
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		c, err := New(name, options[name])
+		if err != nil {
+			return nil, err
+		}
+		collectors = append(collectors, c)
+	}
+
+	return collectors, nil
+}
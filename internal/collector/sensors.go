@@ -0,0 +1,198 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// temperatures, fan speeds and voltages from the linux hwmon and thermal
+// sysfs classes
+type SensorsCollector struct {
+	sysPath string
+}
+
+var hwmonInputPattern = regexp.MustCompile(`^(temp|fan|in)(\d+)_input$`)
+
+func init() {
+	Register("sensors", true, []string{"sys_path"}, func(opts Options) (Collector, error) {
+		c := CreateSensorsCollector()
+		c.sysPath = opts.String("sys_path", c.sysPath)
+		return c, nil
+	})
+}
+
+func CreateSensorsCollector() *SensorsCollector {
+	return &SensorsCollector{
+		sysPath: "/sys",
+	}
+}
+
+func (c *SensorsCollector) Name() string {
+	return "sensors"
+}
+
+func (c *SensorsCollector) Collect() ([]Metric, error) {
+	now := time.Now()
+
+	metrics := c.collectHwmon(now)
+	metrics = append(metrics, c.collectThermalZones(now)...)
+
+	return metrics, nil
+}
+
+// /sys/class/hwmon/hwmonN/{name,temp1_input,temp1_crit,fan1_input,in0_input,...}
+func (c *SensorsCollector) collectHwmon(now time.Time) []Metric {
+	metrics := []Metric{}
+
+	chips, _ := filepath.Glob(filepath.Join(c.sysPath, "class", "hwmon", "hwmon*"))
+	sort.Strings(chips)
+
+	for _, chipDir := range chips {
+		source := filepath.Base(chipDir)
+
+		// older drivers keep their attributes in the device directory
+		attrDir := chipDir
+		if _, err := os.Stat(filepath.Join(chipDir, "name")); err != nil {
+			attrDir = filepath.Join(chipDir, "device")
+		}
+
+		chip := readStringFile(filepath.Join(attrDir, "name"))
+		if chip == "" {
+			chip = source
+		}
+
+		entries, err := os.ReadDir(attrDir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			match := hwmonInputPattern.FindStringSubmatch(entry.Name())
+			if match == nil {
+				continue
+			}
+			kind, prefix := match[1], match[1]+match[2]
+
+			input, err := readIntFile(filepath.Join(attrDir, entry.Name()))
+			if err != nil {
+				continue
+			}
+
+			sensor := readStringFile(filepath.Join(attrDir, prefix+"_label"))
+			if sensor == "" {
+				sensor = prefix
+			}
+
+			labels := map[string]string{
+				"source": source,
+				"chip":   chip,
+				"sensor": sensor,
+			}
+
+			add := func(name string, value float64) {
+				metrics = append(metrics, Metric{
+					Name:      name,
+					Value:     value,
+					Timestamp: now,
+					Labels:    labels,
+				})
+			}
+
+			switch kind {
+			case "temp":
+				// millidegrees celsius
+				add("sensor_temperature_celsius", float64(input)/1000)
+				if crit, err := readIntFile(filepath.Join(attrDir, prefix+"_crit")); err == nil {
+					add("sensor_temperature_critical_celsius", float64(crit)/1000)
+				}
+				if max, err := readIntFile(filepath.Join(attrDir, prefix+"_max")); err == nil {
+					add("sensor_temperature_max_celsius", float64(max)/1000)
+				}
+			case "fan":
+				add("sensor_fan_rpm", float64(input))
+			case "in":
+				// millivolts
+				add("sensor_voltage_volts", float64(input)/1000)
+			}
+		}
+	}
+
+	return metrics
+}
+
+// /sys/class/thermal/thermal_zoneN/{type,temp,trip_point_N_type,trip_point_N_temp}
+func (c *SensorsCollector) collectThermalZones(now time.Time) []Metric {
+	metrics := []Metric{}
+
+	zones, _ := filepath.Glob(filepath.Join(c.sysPath, "class", "thermal", "thermal_zone*"))
+	sort.Strings(zones)
+
+	for _, zoneDir := range zones {
+		source := filepath.Base(zoneDir)
+
+		temp, err := readIntFile(filepath.Join(zoneDir, "temp"))
+		if err != nil {
+			continue
+		}
+
+		zoneType := readStringFile(filepath.Join(zoneDir, "type"))
+		if zoneType == "" {
+			zoneType = source
+		}
+
+		labels := map[string]string{
+			"source": source,
+			"chip":   "thermal",
+			"sensor": zoneType,
+		}
+
+		metrics = append(metrics, Metric{
+			Name:      "sensor_temperature_celsius",
+			Value:     float64(temp) / 1000,
+			Timestamp: now,
+			Labels:    labels,
+		})
+
+		tripTypes, _ := filepath.Glob(filepath.Join(zoneDir, "trip_point_*_type"))
+		for _, tripType := range tripTypes {
+			if readStringFile(tripType) != "critical" {
+				continue
+			}
+
+			crit, err := readIntFile(strings.TrimSuffix(tripType, "_type") + "_temp")
+			if err != nil {
+				continue
+			}
+
+			metrics = append(metrics, Metric{
+				Name:      "sensor_temperature_critical_celsius",
+				Value:     float64(crit) / 1000,
+				Timestamp: now,
+				Labels:    labels,
+			})
+			break
+		}
+	}
+
+	return metrics
+}
+
+// trimmed contents of a small sysfs file, empty if it cannot be read
+func readStringFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// sysfs files holding a single, possibly negative, number
+func readIntFile(path string) (int64, error) {
+	return strconv.ParseInt(readStringFile(path), 10, 64)
+}
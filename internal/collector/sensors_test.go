@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"testing"
+)
+
+// a coretemp chip with labels, an old driver keeping its attributes under
+// device/ and a thermal zone with a critical trip point
+func sensorsFixture(t *testing.T) string {
+	root := t.TempDir()
+
+	writeFixture(t, root, map[string]string{
+		"class/hwmon/hwmon0/name":        "coretemp\n",
+		"class/hwmon/hwmon0/temp1_input": "45500\n",
+		"class/hwmon/hwmon0/temp1_label": "Package id 0\n",
+		"class/hwmon/hwmon0/temp1_crit":  "100000\n",
+		"class/hwmon/hwmon0/temp1_max":   "80000\n",
+		"class/hwmon/hwmon0/temp2_input": "-5000\n",
+		"class/hwmon/hwmon0/temp3_input": "garbage\n",
+
+		"class/hwmon/hwmon1/device/name":       "it8728\n",
+		"class/hwmon/hwmon1/device/fan1_input": "1200\n",
+		"class/hwmon/hwmon1/device/in0_input":  "1212\n",
+		"class/hwmon/hwmon1/device/in0_label":  "Vcore\n",
+
+		"class/thermal/thermal_zone0/type":              "x86_pkg_temp\n",
+		"class/thermal/thermal_zone0/temp":              "52000\n",
+		"class/thermal/thermal_zone0/trip_point_0_type": "passive\n",
+		"class/thermal/thermal_zone0/trip_point_0_temp": "90000\n",
+		"class/thermal/thermal_zone0/trip_point_1_type": "critical\n",
+		"class/thermal/thermal_zone0/trip_point_1_temp": "105000\n",
+
+		// no readable temperature, skipped
+		"class/thermal/thermal_zone1/type": "acpitz\n",
+	})
+
+	return root
+}
+
+func TestSensorsCollectorFixture(t *testing.T) {
+	c := CreateSensorsCollector()
+	c.sysPath = sensorsFixture(t)
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	type key struct{ name, source, chip, sensor string }
+	values := make(map[key]float64)
+	for _, m := range metrics {
+		values[key{m.Name, m.Labels["source"], m.Labels["chip"], m.Labels["sensor"]}] = m.Value
+	}
+
+	expected := map[key]float64{
+		{"sensor_temperature_celsius", "hwmon0", "coretemp", "Package id 0"}:                45.5,
+		{"sensor_temperature_critical_celsius", "hwmon0", "coretemp", "Package id 0"}:       100,
+		{"sensor_temperature_max_celsius", "hwmon0", "coretemp", "Package id 0"}:            80,
+		{"sensor_temperature_celsius", "hwmon0", "coretemp", "temp2"}:                       -5,
+		{"sensor_fan_rpm", "hwmon1", "it8728", "fan1"}:                                      1200,
+		{"sensor_voltage_volts", "hwmon1", "it8728", "Vcore"}:                               1.212,
+		{"sensor_temperature_celsius", "thermal_zone0", "thermal", "x86_pkg_temp"}:          52,
+		{"sensor_temperature_critical_celsius", "thermal_zone0", "thermal", "x86_pkg_temp"}: 105,
+	}
+
+	for k, value := range expected {
+		got, ok := values[k]
+		if !ok {
+			t.Errorf("missing %+v", k)
+			continue
+		}
+		if got != value {
+			t.Errorf("%+v = %v, want %v", k, got, value)
+		}
+	}
+
+	if len(metrics) != len(expected) {
+		t.Errorf("got %d metrics, want %d: %+v", len(metrics), len(expected), metrics)
+	}
+}
+
+func TestSensorsCollectorNoSensors(t *testing.T) {
+	c := CreateSensorsCollector()
+	c.sysPath = t.TempDir()
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if len(metrics) != 0 {
+		t.Errorf("got %d metrics without hwmon or thermal, want 0", len(metrics))
+	}
+}
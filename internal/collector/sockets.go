@@ -0,0 +1,353 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// socket states and protocol counters from /proc/net
+type SocketsCollector struct {
+	procPath string
+
+	lastSNMP    map[string]map[string]int64
+	lastCollect time.Time
+	mutex       sync.Mutex
+}
+
+// "st" column of /proc/net/tcp, see include/net/tcp_states.h
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+	"0C": "NEW_SYN_RECV",
+}
+
+// counters reported from /proc/net/snmp, in a fixed order
+var snmpMetrics = []struct {
+	protocol, field, name string
+}{
+	{"Tcp", "ActiveOpens", "socket_tcp_active_opens_total"},
+	{"Tcp", "PassiveOpens", "socket_tcp_passive_opens_total"},
+	{"Tcp", "AttemptFails", "socket_tcp_attempt_fails_total"},
+	{"Tcp", "EstabResets", "socket_tcp_established_resets_total"},
+	{"Tcp", "CurrEstab", "socket_tcp_current_established"},
+	{"Tcp", "InSegs", "socket_tcp_segments_received_total"},
+	{"Tcp", "OutSegs", "socket_tcp_segments_sent_total"},
+	{"Tcp", "RetransSegs", "socket_tcp_segments_retransmitted_total"},
+	{"Tcp", "InErrs", "socket_tcp_receive_errors_total"},
+	{"Tcp", "OutRsts", "socket_tcp_resets_sent_total"},
+	{"Udp", "InDatagrams", "socket_udp_datagrams_received_total"},
+	{"Udp", "OutDatagrams", "socket_udp_datagrams_sent_total"},
+	{"Udp", "NoPorts", "socket_udp_no_port_total"},
+	{"Udp", "InErrors", "socket_udp_receive_errors_total"},
+	{"Udp", "RcvbufErrors", "socket_udp_receive_buffer_errors_total"},
+	{"Udp", "SndbufErrors", "socket_udp_send_buffer_errors_total"},
+}
+
+// tcp snmp counters also reported as per-second rates
+var snmpRateMetrics = []struct {
+	field, name string
+}{
+	{"InSegs", "socket_tcp_segments_received_per_second"},
+	{"OutSegs", "socket_tcp_segments_sent_per_second"},
+	{"RetransSegs", "socket_tcp_segments_retransmitted_per_second"},
+}
+
+func init() {
+	Register("sockets", true, []string{"proc_path"}, func(opts Options) (Collector, error) {
+		c := CreateSocketsCollector()
+		c.procPath = opts.String("proc_path", c.procPath)
+		return c, nil
+	})
+}
+
+func CreateSocketsCollector() *SocketsCollector {
+	return &SocketsCollector{
+		procPath: "/proc",
+	}
+}
+
+func (c *SocketsCollector) Name() string {
+	return "sockets"
+}
+
+func (c *SocketsCollector) Collect() ([]Metric, error) {
+	metrics := []Metric{}
+	now := time.Now()
+
+	// connection states, tcp and tcp6 combined
+	stateCounts := make(map[string]int)
+	for _, state := range tcpStates {
+		stateCounts[state] = 0
+	}
+
+	listening := make(map[string]map[string]string)
+	udpSockets := 0
+
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		sockets, err := readProcNetSockets(filepath.Join(c.procPath, "net", protocol))
+		if os.IsNotExist(err) {
+			// no ipv6 support
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading /proc/net/%s: %v", protocol, err)
+		}
+
+		for _, socket := range sockets {
+			isTCP := strings.HasPrefix(protocol, "tcp")
+			if isTCP {
+				stateCounts[tcpStates[socket.state]]++
+			} else {
+				udpSockets++
+			}
+
+			// listening tcp sockets and unconnected (bound) udp sockets
+			if (isTCP && socket.state == "0A") || (!isTCP && socket.state == "07") {
+				key := protocol + " " + socket.address + " " + socket.port
+				listening[key] = map[string]string{
+					"protocol": protocol,
+					"address":  socket.address,
+					"port":     socket.port,
+				}
+			}
+		}
+	}
+
+	states := make([]string, 0, len(stateCounts))
+	for state := range stateCounts {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	for _, state := range states {
+		metrics = append(metrics, Metric{
+			Name:      "socket_tcp_connections",
+			Value:     float64(stateCounts[state]),
+			Timestamp: now,
+			Labels:    map[string]string{"state": state},
+		})
+	}
+
+	metrics = append(metrics, Metric{
+		Name:      "socket_udp_sockets",
+		Value:     float64(udpSockets),
+		Timestamp: now,
+		Labels:    map[string]string{},
+	})
+
+	listeningKeys := make([]string, 0, len(listening))
+	for key := range listening {
+		listeningKeys = append(listeningKeys, key)
+	}
+	sort.Strings(listeningKeys)
+
+	for _, key := range listeningKeys {
+		metrics = append(metrics, Metric{
+			Name:      "socket_listening",
+			Value:     1,
+			Timestamp: now,
+			Labels:    listening[key],
+		})
+	}
+
+	for _, file := range []string{"sockstat", "sockstat6"} {
+		sockstatMetrics, err := readSockstat(filepath.Join(c.procPath, "net", file), now)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading /proc/net/%s: %v", file, err)
+		}
+		metrics = append(metrics, sockstatMetrics...)
+	}
+
+	snmp, err := readProcNetSNMP(filepath.Join(c.procPath, "net", "snmp"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading /proc/net/snmp: %v", err)
+	}
+
+	for _, counter := range snmpMetrics {
+		value, ok := snmp[counter.protocol][counter.field]
+		if !ok {
+			continue
+		}
+		metrics = append(metrics, Metric{
+			Name:      counter.name,
+			Value:     float64(value),
+			Timestamp: now,
+			Labels:    map[string]string{},
+		})
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timeSinceLastCollect := now.Sub(c.lastCollect).Seconds()
+	if c.lastSNMP != nil && timeSinceLastCollect > 0 {
+		for _, counter := range snmpRateMetrics {
+			current, last := snmp["Tcp"][counter.field], c.lastSNMP["Tcp"][counter.field]
+			if current < 0 || last < 0 {
+				continue
+			}
+			metrics = append(metrics, Metric{
+				Name:      counter.name,
+				Value:     counterRate(uint64(current), uint64(last), timeSinceLastCollect),
+				Timestamp: now,
+				Labels:    map[string]string{},
+			})
+		}
+	}
+
+	c.lastSNMP = snmp
+	c.lastCollect = now
+
+	return metrics, nil
+}
+
+type procNetSocket struct {
+	address string
+	port    string
+	state   string
+}
+
+// local address and state of every socket in /proc/net/{tcp,tcp6,udp,udp6}
+func readProcNetSockets(path string) ([]procNetSocket, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sockets := []procNetSocket{}
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+
+	for scanner.Scan() {
+		// sl local_address rem_address st ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		hexAddress, hexPort, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			continue
+		}
+
+		port, err := strconv.ParseUint(hexPort, 16, 16)
+		if err != nil {
+			continue
+		}
+
+		sockets = append(sockets, procNetSocket{
+			address: decodeProcNetAddress(hexAddress),
+			port:    strconv.FormatUint(port, 10),
+			state:   fields[3],
+		})
+	}
+
+	return sockets, scanner.Err()
+}
+
+// addresses are printed as 32-bit words in host (little endian) byte order
+func decodeProcNetAddress(hexAddress string) string {
+	raw, err := hex.DecodeString(hexAddress)
+	if err != nil || len(raw)%4 != 0 {
+		return hexAddress
+	}
+
+	ip := make(net.IP, len(raw))
+	for word := 0; word < len(raw); word += 4 {
+		for i := 0; i < 4; i++ {
+			ip[word+i] = raw[word+3-i]
+		}
+	}
+
+	return ip.String()
+}
+
+// lines of the form "TCP: inuse 4 orphan 0 tw 2 alloc 4 mem 0", reported as
+// sockstat_tcp_inuse, sockstat_tcp_tw, ...
+func readSockstat(path string, now time.Time) ([]Metric, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	metrics := []Metric{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		protocol := strings.ToLower(strings.TrimSuffix(fields[0], ":"))
+		for i := 1; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i+1], 64)
+			if err != nil {
+				continue
+			}
+			metrics = append(metrics, Metric{
+				Name:      "sockstat_" + protocol + "_" + fields[i],
+				Value:     value,
+				Timestamp: now,
+				Labels:    map[string]string{},
+			})
+		}
+	}
+
+	return metrics, scanner.Err()
+}
+
+// /proc/net/snmp pairs a header line with a value line per protocol:
+//
+//	Tcp: RtoAlgorithm RtoMin ...
+//	Tcp: 1 200 ...
+func readProcNetSNMP(path string) (map[string]map[string]int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := make(map[string]map[string]int64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		header := strings.Fields(scanner.Text())
+		if !scanner.Scan() {
+			break
+		}
+		values := strings.Fields(scanner.Text())
+
+		if len(header) == 0 || len(header) != len(values) || header[0] != values[0] {
+			continue
+		}
+
+		protocol := strings.TrimSuffix(header[0], ":")
+		result[protocol] = make(map[string]int64)
+		for i := 1; i < len(header); i++ {
+			if value, err := strconv.ParseInt(values[i], 10, 64); err == nil {
+				result[protocol][header[i]] = value
+			}
+		}
+	}
+
+	return result, scanner.Err()
+}
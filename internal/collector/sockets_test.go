@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+const procNetHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+func procNetSNMPFixture(inSegs, outSegs, retransSegs int) string {
+	return "Ip: Forwarding DefaultTTL InReceives\n" +
+		"Ip: 1 64 12345\n" +
+		"Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens AttemptFails EstabResets CurrEstab InSegs OutSegs RetransSegs InErrs OutRsts InCsumErrors\n" +
+		fmt.Sprintf("Tcp: 1 200 120000 -1 10 20 1 2 3 %d %d %d 0 4 0\n", inSegs, outSegs, retransSegs) +
+		"Udp: InDatagrams NoPorts InErrors OutDatagrams RcvbufErrors SndbufErrors InCsumErrors IgnoredMulti\n" +
+		"Udp: 500 6 0 400 0 0 0 0\n"
+}
+
+// tcp with a listener and an established connection, tcp6 listening on ::1,
+// udp with a bound and a connected socket, and no udp6
+func socketsFixture(t *testing.T) string {
+	root := t.TempDir()
+
+	writeFixture(t, root, map[string]string{
+		"net/tcp": procNetHeader +
+			"   0: 0100007F:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001\n" +
+			"   1: 0100007F:1F90 0100007F:D431 01 00000000:00000000 00:00000000 00000000  1000        0 1002\n",
+		"net/tcp6": procNetHeader +
+			"   0: 00000000000000000000000001000000:0050 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1003\n",
+		"net/udp": procNetHeader +
+			"   0: 00000000:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 1004\n" +
+			"   1: 0F02000A:A1B2 08080808:0035 01 00000000:00000000 00:00000000 00000000     0        0 1005\n",
+		"net/sockstat": "sockets: used 120\n" +
+			"TCP: inuse 4 orphan 0 tw 2 alloc 5 mem 1\n" +
+			"UDP: inuse 2 mem 0\n",
+		"net/snmp": procNetSNMPFixture(1000, 800, 10),
+	})
+
+	return root
+}
+
+func TestSocketsCollectorFixture(t *testing.T) {
+	c := CreateSocketsCollector()
+	c.procPath = socketsFixture(t)
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	values := make(map[string]float64)
+	listening := make(map[string]bool)
+	for _, m := range metrics {
+		switch m.Name {
+		case "socket_tcp_connections":
+			values[m.Name+" "+m.Labels["state"]] = m.Value
+		case "socket_listening":
+			listening[m.Labels["protocol"]+" "+m.Labels["address"]+" "+m.Labels["port"]] = true
+		default:
+			values[m.Name] = m.Value
+		}
+	}
+
+	expected := map[string]float64{
+		"socket_tcp_connections LISTEN":      2,
+		"socket_tcp_connections ESTABLISHED": 1,
+		"socket_tcp_connections TIME_WAIT":   0,
+		"socket_udp_sockets":                 2,
+
+		"sockstat_sockets_used": 120,
+		"sockstat_tcp_inuse":    4,
+		"sockstat_tcp_tw":       2,
+		"sockstat_udp_inuse":    2,
+
+		"socket_tcp_active_opens_total":           10,
+		"socket_tcp_current_established":          3,
+		"socket_tcp_segments_received_total":      1000,
+		"socket_tcp_segments_retransmitted_total": 10,
+		"socket_tcp_resets_sent_total":            4,
+		"socket_udp_datagrams_received_total":     500,
+		"socket_udp_no_port_total":                6,
+	}
+	for name, value := range expected {
+		got, ok := values[name]
+		if !ok {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		if got != value {
+			t.Errorf("%s = %v, want %v", name, got, value)
+		}
+	}
+
+	expectedListening := []string{"tcp 127.0.0.1 22", "tcp6 ::1 80", "udp 0.0.0.0 53"}
+	for _, key := range expectedListening {
+		if !listening[key] {
+			t.Errorf("missing listening socket %s", key)
+		}
+	}
+	if len(listening) != len(expectedListening) {
+		t.Errorf("got listening sockets %v, want %v", listening, expectedListening)
+	}
+
+	// rates need a previous sample
+	if _, ok := values["socket_tcp_segments_received_per_second"]; ok {
+		t.Error("unexpected rate on the first collect")
+	}
+}
+
+func TestSocketsCollectorRates(t *testing.T) {
+	root := socketsFixture(t)
+	c := CreateSocketsCollector()
+	c.procPath = root
+
+	if _, err := c.Collect(); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	c.lastCollect = time.Now().Add(-2 * time.Second)
+	writeFixture(t, root, map[string]string{"net/snmp": procNetSNMPFixture(3000, 1800, 20)})
+
+	metrics, err := c.Collect()
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, m := range metrics {
+		values[m.Name] = m.Value
+	}
+
+	expected := map[string]float64{
+		"socket_tcp_segments_received_per_second":      1000,
+		"socket_tcp_segments_sent_per_second":          500,
+		"socket_tcp_segments_retransmitted_per_second": 5,
+	}
+	for name, want := range expected {
+		got, ok := values[name]
+		if !ok {
+			t.Errorf("missing %s", name)
+			continue
+		}
+		// the interval is measured, so allow for the time Collect took
+		if got > want || got < want*0.95 {
+			t.Errorf("%s = %v, want about %v", name, got, want)
+		}
+	}
+}
+
+func TestDecodeProcNetAddress(t *testing.T) {
+	tests := map[string]string{
+		"0100007F":                         "127.0.0.1",
+		"00000000":                         "0.0.0.0",
+		"0F02000A":                         "10.0.2.15",
+		"00000000000000000000000001000000": "::1",
+		"0000000000000000FFFF00000100007F": "127.0.0.1",
+		"B80D01200000000000000000EFCDAB89": "2001:db8::89ab:cdef",
+		"XYZ":                              "XYZ",
+	}
+
+	for hexAddress, want := range tests {
+		if got := decodeProcNetAddress(hexAddress); got != want {
+			t.Errorf("decodeProcNetAddress(%q) = %q, want %q", hexAddress, got, want)
+		}
+	}
+}
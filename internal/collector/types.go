@@ -1,10 +1,39 @@
 package collector
 
-import "time"
+import (
+	"path"
 
-type Metric struct {
-	Name      string            `json:"name"`
-	Value     float64           `json:"value"`
-	Timestamp time.Time         `json:"timestamp"`
-	Labels    map[string]string `json:"labels"`
+	"ddgo/protocol"
+)
+
+// collectors produce wire metrics directly
+type Metric = protocol.Metric
+
+// increase of a monotonic counter, 0 if the counter was reset
+func counterDelta(current, last uint64) float64 {
+	if current < last {
+		return 0
+	}
+
+	return float64(current - last)
+}
+
+// per-second rate of a monotonic counter, 0 if the counter was reset
+func counterRate(current, last uint64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+
+	return counterDelta(current, last) / seconds
+}
+
+// whether value matches any of the glob patterns
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+
+	return false
 }
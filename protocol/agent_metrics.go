@@ -0,0 +1,351 @@
+package protocol
+
+import (
+	"fmt"
+	"time"
+)
+
+// version of the nested v1 payload; agents predating schema versions send 0
+const LegacySchemaVersion = 1
+
+// v1 payload, the nested per-agent view served to the frontend
+type AgentMetrics struct {
+	SchemaVersion int               `json:"schema_version,omitempty"`
+	AgentID       string            `json:"agent_id"`
+	Hostname      string            `json:"hostname"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Host          *HostInfo         `json:"host,omitempty"`
+	Metrics       SystemMetrics     `json:"metrics"`
+	Errors        []CollectorError  `json:"errors,omitempty"`
+	Timestamp     time.Time         `json:"timestamp"`
+}
+
+type SystemMetrics struct {
+	CPU         CPUMetrics                  `json:"cpu"`
+	Pressure    PressureMetrics             `json:"pressure"`
+	Memory      MemoryMetrics               `json:"memory"`
+	Disk        map[string]DiskDevice       `json:"disk"`
+	Filesystems []Filesystem                `json:"filesystems"`
+	Network     map[string]NetworkInterface `json:"network"`
+	Processes   []Process                   `json:"processes"`
+	Cgroups     []Cgroup                    `json:"cgroups"`
+	Sensors     []Sensor                    `json:"sensors"`
+	Sockets     SocketMetrics               `json:"sockets"`
+	Time        string                      `json:"time"`
+}
+
+type CPUMetrics struct {
+	Usage  float64             `json:"usage"`
+	Modes  map[string]float64  `json:"modes"`
+	Cores  []CPUCore           `json:"cores"`
+	Trends map[string]CPUTrend `json:"trends"`
+	Load   CPULoad             `json:"load"`
+	Times  map[string]CPUTimes `json:"times"`
+	Info   CPUInfo             `json:"info"`
+	Stats  CPUStats            `json:"stats"`
+}
+
+// usage of a single logical cpu
+type CPUCore struct {
+	Core  int                `json:"core"`
+	Usage float64            `json:"usage"`
+	Modes map[string]float64 `json:"modes"`
+}
+
+type CPULoad struct {
+	OneMin     float64 `json:"1m"`
+	FiveMin    float64 `json:"5m"`
+	FifteenMin float64 `json:"15m"`
+}
+
+// cumulative seconds spent in each mode since boot
+type CPUTimes struct {
+	User   float64 `json:"user"`
+	System float64 `json:"system"`
+	Idle   float64 `json:"idle"`
+	IOWait float64 `json:"iowait"`
+	IRQ    float64 `json:"irq"`
+}
+
+type CPUInfo struct {
+	ProcessCount  int `json:"process_count"`
+	ThreadCount   int `json:"thread_count"`
+	LogicalCores  int `json:"logical_cores"`
+	PhysicalCores int `json:"physical_cores"`
+}
+
+// scheduler counters from /proc/stat
+type CPUStats struct {
+	ContextSwitches          uint64  `json:"context_switches"`
+	ContextSwitchesPerSecond float64 `json:"context_switches_per_second"`
+	Interrupts               uint64  `json:"interrupts"`
+	InterruptsPerSecond      float64 `json:"interrupts_per_second"`
+	Forks                    uint64  `json:"forks"`
+	ForksPerSecond           float64 `json:"forks_per_second"`
+	ProcsRunning             int     `json:"procs_running"`
+	ProcsBlocked             int     `json:"procs_blocked"`
+}
+
+// usage trends of one cpu (or "total"), keyed by window
+type CPUTrend struct {
+	MovingAverage map[string]float64 `json:"moving_average"`
+	RateOfChange  map[string]float64 `json:"rate_of_change"`
+	SustainedHigh bool               `json:"sustained_high"`
+}
+
+type PressureMetrics struct {
+	Supported bool             `json:"supported"`
+	CPU       PressureResource `json:"cpu"`
+	Memory    PressureResource `json:"memory"`
+	IO        PressureResource `json:"io"`
+}
+
+// stall averages (percent of wall time) and total stall time for one resource
+type PressureResource struct {
+	Some PressureStall `json:"some"`
+	Full PressureStall `json:"full"`
+}
+
+type PressureStall struct {
+	Avg10        float64 `json:"avg10"`
+	Avg60        float64 `json:"avg60"`
+	Avg300       float64 `json:"avg300"`
+	TotalSeconds float64 `json:"total_seconds"`
+}
+
+type MemoryMetrics struct {
+	Virtual   VirtualMemory `json:"virtual"`
+	Swap      SwapMemory    `json:"swap"`
+	Paged     PagedMemory   `json:"paged"`
+	HugePages HugePages     `json:"hugepages"`
+	Paging    PagingStats   `json:"paging"`
+}
+
+type VirtualMemory struct {
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	Free        uint64  `json:"free"`
+	Usage       float64 `json:"usage"`
+	Cached      uint64  `json:"cached"`
+	Available   uint64  `json:"available"`
+	Committed   uint64  `json:"committed"`
+	CommitLimit uint64  `json:"commit_limit"`
+}
+
+type SwapMemory struct {
+	Total            uint64  `json:"total"`
+	Used             uint64  `json:"used"`
+	Free             uint64  `json:"free"`
+	Usage            float64 `json:"usage"`
+	SwapIn           uint64  `json:"swap_in"`
+	SwapOut          uint64  `json:"swap_out"`
+	SwapInPerSecond  float64 `json:"swap_in_per_second"`
+	SwapOutPerSecond float64 `json:"swap_out_per_second"`
+}
+
+type PagedMemory struct {
+	PageTables    uint64 `json:"page_tables"`
+	Mapped        uint64 `json:"mapped"`
+	Slab          uint64 `json:"slab"`
+	PageCache     uint64 `json:"page_cache"`
+	WritebackTemp uint64 `json:"writeback_temp"`
+	Dirty         uint64 `json:"dirty"`
+	Writeback     uint64 `json:"writeback"`
+}
+
+type HugePages struct {
+	Total    uint64 `json:"total"`
+	Free     uint64 `json:"free"`
+	Reserved uint64 `json:"reserved"`
+	Surplus  uint64 `json:"surplus"`
+	PageSize uint64 `json:"page_size"`
+}
+
+// page fault, reclaim and oom counters from /proc/vmstat
+type PagingStats struct {
+	MajorFaults          uint64  `json:"major_faults"`
+	MinorFaults          uint64  `json:"minor_faults"`
+	MajorFaultsPerSecond float64 `json:"major_faults_per_second"`
+	MinorFaultsPerSecond float64 `json:"minor_faults_per_second"`
+	PagesScanned         uint64  `json:"pages_scanned"`
+	PagesReclaimed       uint64  `json:"pages_reclaimed"`
+	ScannedPerSecond     float64 `json:"scanned_per_second"`
+	ReclaimedPerSecond   float64 `json:"reclaimed_per_second"`
+	OOMKills             uint64  `json:"oom_kills"`
+}
+
+// io counters and rates of a single block device
+type DiskDevice struct {
+	ReadCount           uint64  `json:"read_count"`
+	WriteCount          uint64  `json:"write_count"`
+	ReadBytes           uint64  `json:"read_bytes"`
+	WriteBytes          uint64  `json:"write_bytes"`
+	ReadBytesPerSecond  float64 `json:"read_bytes_per_second"`
+	WriteBytesPerSecond float64 `json:"write_bytes_per_second"`
+	ReadIOPS            float64 `json:"read_iops"`
+	WriteIOPS           float64 `json:"write_iops"`
+	TotalIOPS           float64 `json:"total_iops"`
+	IOInProgress        uint64  `json:"io_in_progress"`
+	ReadAwaitMs         float64 `json:"read_await_ms"`
+	WriteAwaitMs        float64 `json:"write_await_ms"`
+	Utilization         float64 `json:"utilization"`
+	QueueDepth          float64 `json:"queue_depth"`
+}
+
+// usage of a single mounted filesystem
+type Filesystem struct {
+	Mountpoint  string  `json:"mountpoint"`
+	Device      string  `json:"device"`
+	Fstype      string  `json:"fstype"`
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	Free        uint64  `json:"free"`
+	Usage       float64 `json:"usage"`
+	InodesTotal uint64  `json:"inodes_total"`
+	InodesUsed  uint64  `json:"inodes_used"`
+	InodesFree  uint64  `json:"inodes_free"`
+	InodesUsage float64 `json:"inodes_usage"`
+}
+
+// per-interface network counters and rates
+type NetworkInterface struct {
+	BytesRecv            uint64  `json:"bytes_recv"`
+	BytesSent            uint64  `json:"bytes_sent"`
+	PacketsRecv          uint64  `json:"packets_recv"`
+	PacketsSent          uint64  `json:"packets_sent"`
+	ErrorsIn             uint64  `json:"errors_in"`
+	ErrorsOut            uint64  `json:"errors_out"`
+	DropsIn              uint64  `json:"drops_in"`
+	DropsOut             uint64  `json:"drops_out"`
+	RecvBytesPerSecond   float64 `json:"recv_bytes_per_second"`
+	SentBytesPerSecond   float64 `json:"sent_bytes_per_second"`
+	RecvPacketsPerSecond float64 `json:"recv_packets_per_second"`
+	SentPacketsPerSecond float64 `json:"sent_packets_per_second"`
+	ErrorsInPerSecond    float64 `json:"errors_in_per_second"`
+	ErrorsOutPerSecond   float64 `json:"errors_out_per_second"`
+	DropsInPerSecond     float64 `json:"drops_in_per_second"`
+	DropsOutPerSecond    float64 `json:"drops_out_per_second"`
+}
+
+// resource usage of a single reported process
+type Process struct {
+	PID                 int32   `json:"pid"`
+	Name                string  `json:"name"`
+	User                string  `json:"user"`
+	Cmdline             string  `json:"cmdline"`
+	CPUPercent          float64 `json:"cpu_percent"`
+	RSS                 uint64  `json:"rss"`
+	OpenFDs             int     `json:"open_fds"`
+	ReadBytes           uint64  `json:"read_bytes"`
+	WriteBytes          uint64  `json:"write_bytes"`
+	ReadBytesPerSecond  float64 `json:"read_bytes_per_second"`
+	WriteBytesPerSecond float64 `json:"write_bytes_per_second"`
+}
+
+// resource usage of a single cgroup
+type Cgroup struct {
+	Path             string  `json:"path"`
+	ContainerID      string  `json:"container_id,omitempty"`
+	CPUUsageSeconds  float64 `json:"cpu_usage_seconds"`
+	CPUUserSeconds   float64 `json:"cpu_user_seconds"`
+	CPUSystemSeconds float64 `json:"cpu_system_seconds"`
+	CPUUsagePercent  float64 `json:"cpu_usage_percent"`
+	CPUPeriods       uint64  `json:"cpu_periods"`
+	ThrottledPeriods uint64  `json:"throttled_periods"`
+	ThrottledSeconds float64 `json:"throttled_seconds"`
+	MemoryCurrent    uint64  `json:"memory_current"`
+	MemoryMax        uint64  `json:"memory_max"` // 0 when unlimited
+	OOMEvents        uint64  `json:"oom_events"`
+	OOMKills         uint64  `json:"oom_kills"`
+	IOReadBytes      uint64  `json:"io_read_bytes"`
+	IOWriteBytes     uint64  `json:"io_write_bytes"`
+	IOReadOps        uint64  `json:"io_read_ops"`
+	IOWriteOps       uint64  `json:"io_write_ops"`
+}
+
+// a single hardware sensor reading
+type Sensor struct {
+	Source   string  `json:"source"`
+	Chip     string  `json:"chip"`
+	Sensor   string  `json:"sensor"`
+	Type     string  `json:"type"`  // temperature, fan or voltage
+	Value    float64 `json:"value"` // celsius, rpm or volts
+	Critical float64 `json:"critical,omitempty"`
+	Max      float64 `json:"max,omitempty"`
+}
+
+// a listening tcp or bound udp socket
+type ListeningSocket struct {
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+}
+
+type SocketMetrics struct {
+	TCPStates  map[string]int     `json:"tcp_states"`
+	UDPSockets int                `json:"udp_sockets"`
+	Listening  []ListeningSocket  `json:"listening"`
+	Sockstat   map[string]float64 `json:"sockstat"`
+	TCP        TCPStats           `json:"tcp"`
+	UDP        UDPStats           `json:"udp"`
+}
+
+// tcp counters from /proc/net/snmp
+type TCPStats struct {
+	ActiveOpens                    uint64  `json:"active_opens"`
+	PassiveOpens                   uint64  `json:"passive_opens"`
+	AttemptFails                   uint64  `json:"attempt_fails"`
+	EstablishedResets              uint64  `json:"established_resets"`
+	CurrentEstablished             uint64  `json:"current_established"`
+	SegmentsReceived               uint64  `json:"segments_received"`
+	SegmentsSent                   uint64  `json:"segments_sent"`
+	SegmentsRetransmitted          uint64  `json:"segments_retransmitted"`
+	ReceiveErrors                  uint64  `json:"receive_errors"`
+	ResetsSent                     uint64  `json:"resets_sent"`
+	SegmentsReceivedPerSecond      float64 `json:"segments_received_per_second"`
+	SegmentsSentPerSecond          float64 `json:"segments_sent_per_second"`
+	SegmentsRetransmittedPerSecond float64 `json:"segments_retransmitted_per_second"`
+}
+
+// udp counters from /proc/net/snmp
+type UDPStats struct {
+	DatagramsReceived   uint64 `json:"datagrams_received"`
+	DatagramsSent       uint64 `json:"datagrams_sent"`
+	NoPort              uint64 `json:"no_port"`
+	ReceiveErrors       uint64 `json:"receive_errors"`
+	ReceiveBufferErrors uint64 `json:"receive_buffer_errors"`
+	SendBufferErrors    uint64 `json:"send_buffer_errors"`
+}
+
+// build the v1 view of a v2 payload
+func NewAgentMetrics(payload MetricsPayload) AgentMetrics {
+	metrics := AgentMetrics{
+		SchemaVersion: LegacySchemaVersion,
+		AgentID:       payload.AgentID,
+		Hostname:      payload.Hostname,
+		Labels:        payload.Labels,
+		Host:          payload.Host,
+		Errors:        payload.Errors,
+		Timestamp:     payload.Timestamp,
+	}
+
+	folder := newFolder(&metrics)
+	for _, metric := range payload.Metrics {
+		folder.add(metric)
+	}
+	metrics.Metrics.Time = payload.Timestamp.Format(time.RFC3339)
+
+	return metrics
+}
+
+func (m AgentMetrics) Validate() error {
+	if m.SchemaVersion != 0 && m.SchemaVersion != LegacySchemaVersion {
+		return fmt.Errorf("unsupported schema version %d", m.SchemaVersion)
+	}
+
+	if m.AgentID == "" {
+		return fmt.Errorf("missing agent_id")
+	}
+
+	return nil
+}
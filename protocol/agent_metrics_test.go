@@ -0,0 +1,132 @@
+package protocol
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewAgentMetrics(t *testing.T) {
+	payload := testPayload()
+	now := payload.Timestamp
+
+	metric := func(name string, value float64, labels map[string]string) Metric {
+		return Metric{Name: name, Value: value, Timestamp: now, Labels: labels}
+	}
+	payload.Metrics = append(payload.Metrics,
+		metric("cpu_mode_percent", 30, map[string]string{"cpu": "total", "mode": "user"}),
+		metric("cpu_usage", 80, map[string]string{"cpu": "cpu1"}),
+		metric("cpu_mode_percent", 60, map[string]string{"cpu": "cpu1", "mode": "system"}),
+		metric("cpu_load_average_1m", 1.5, map[string]string{}),
+		metric("disk_usage", 55, map[string]string{"mountpoint": "/", "device": "/dev/sda1", "fstype": "ext4"}),
+		metric("network_receive_bytes_total", 1024, map[string]string{"interface": "eth0"}),
+		metric("cgroup_memory_current_bytes", 4096, map[string]string{"cgroup": "/system.slice"}),
+		metric("cgroup_cpu_usage_seconds_total", 2, map[string]string{"cgroup": "/user.slice"}),
+		metric("cgroup_cpu_usage_seconds_total", 3, map[string]string{"cgroup": "/system.slice"}),
+	)
+
+	legacy := NewAgentMetrics(payload)
+
+	if legacy.SchemaVersion != LegacySchemaVersion {
+		t.Errorf("SchemaVersion = %d, want %d", legacy.SchemaVersion, LegacySchemaVersion)
+	}
+	if legacy.AgentID != "agent-1" || legacy.Hostname != "web-1" || legacy.Labels["env"] != "dev" {
+		t.Errorf("identity not copied: %q %q %v", legacy.AgentID, legacy.Hostname, legacy.Labels)
+	}
+	if legacy.Host == nil || legacy.Host.OS != "linux" {
+		t.Errorf("Host = %+v, want linux", legacy.Host)
+	}
+	if len(legacy.Errors) != 1 || legacy.Errors[0].Collector != "sensors" {
+		t.Errorf("Errors = %+v, want the sensors error", legacy.Errors)
+	}
+	if legacy.Metrics.Time != now.Format(time.RFC3339) {
+		t.Errorf("Time = %q, want %q", legacy.Metrics.Time, now.Format(time.RFC3339))
+	}
+
+	cpu := legacy.Metrics.CPU
+	if cpu.Usage != 42.5 || cpu.Modes["user"] != 30 {
+		t.Errorf("cpu usage = %v modes = %v, want 42.5 and user 30", cpu.Usage, cpu.Modes)
+	}
+	if len(cpu.Cores) != 1 || cpu.Cores[0].Core != 1 || cpu.Cores[0].Usage != 80 || cpu.Cores[0].Modes["system"] != 60 {
+		t.Errorf("Cores = %+v, want cpu1 at 80 with system 60", cpu.Cores)
+	}
+	if cpu.Load.OneMin != 1.5 {
+		t.Errorf("Load.OneMin = %v, want 1.5", cpu.Load.OneMin)
+	}
+
+	if legacy.Metrics.Memory.Virtual.Total != 8<<30 {
+		t.Errorf("Memory.Virtual.Total = %d, want %d", legacy.Metrics.Memory.Virtual.Total, uint64(8<<30))
+	}
+
+	filesystems := legacy.Metrics.Filesystems
+	if len(filesystems) != 1 || filesystems[0].Mountpoint != "/" || filesystems[0].Fstype != "ext4" || filesystems[0].Usage != 55 {
+		t.Errorf("Filesystems = %+v, want / on ext4 at 55", filesystems)
+	}
+
+	if legacy.Metrics.Network["eth0"].BytesRecv != 1024 {
+		t.Errorf("Network[eth0].BytesRecv = %d, want 1024", legacy.Metrics.Network["eth0"].BytesRecv)
+	}
+
+	cgroups := legacy.Metrics.Cgroups
+	if len(cgroups) != 2 {
+		t.Fatalf("got %d cgroups, want 2: %+v", len(cgroups), cgroups)
+	}
+	if cgroups[0].Path != "/system.slice" || cgroups[0].MemoryCurrent != 4096 || cgroups[0].CPUUsageSeconds != 3 {
+		t.Errorf("cgroups[0] = %+v, want /system.slice with both metrics", cgroups[0])
+	}
+	if cgroups[1].Path != "/user.slice" || cgroups[1].CPUUsageSeconds != 2 {
+		t.Errorf("cgroups[1] = %+v, want /user.slice", cgroups[1])
+	}
+}
+
+// folding into a decoded view updates its cgroups instead of duplicating them
+func TestAgentMetricsAddAfterDecode(t *testing.T) {
+	legacy := NewAgentMetrics(MetricsPayload{
+		AgentID:   "agent-1",
+		Timestamp: time.Now(),
+		Metrics: []Metric{
+			{Name: "cgroup_memory_current_bytes", Value: 1, Labels: map[string]string{"cgroup": "/a"}},
+		},
+	})
+
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var decoded AgentMetrics
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	decoded.Add(Metric{Name: "cgroup_memory_current_bytes", Value: 2, Labels: map[string]string{"cgroup": "/a"}})
+
+	if len(decoded.Metrics.Cgroups) != 1 || decoded.Metrics.Cgroups[0].MemoryCurrent != 2 {
+		t.Errorf("Cgroups = %+v, want /a updated to 2", decoded.Metrics.Cgroups)
+	}
+}
+
+func TestAgentMetricsValidate(t *testing.T) {
+	tests := []struct {
+		metrics AgentMetrics
+		err     string
+	}{
+		{metrics: AgentMetrics{AgentID: "agent-1"}},
+		{metrics: AgentMetrics{SchemaVersion: LegacySchemaVersion, AgentID: "agent-1"}},
+		{metrics: AgentMetrics{SchemaVersion: SchemaVersion, AgentID: "agent-1"}, err: "unsupported schema version 2"},
+		{metrics: AgentMetrics{SchemaVersion: LegacySchemaVersion}, err: "missing agent_id"},
+	}
+
+	for _, tt := range tests {
+		err := tt.metrics.Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("Validate(%+v) = %v, want nil", tt.metrics, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Validate(%+v) = %v, want error containing %q", tt.metrics, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content-Encoding values understood by the server
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// returned for Content-Encoding values other than the ones above
+var ErrUnsupportedEncoding = errors.New("unsupported encoding")
+
+// safe for concurrent EncodeAll calls
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+// compress a request body, "" leaves it as is
+func Compress(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return data, nil
+	case EncodingGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case EncodingZstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+}
+
+// reader decompressing a request body sent with the given encoding
+func Decompress(body io.Reader, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case EncodingGzip:
+		return gzip.NewReader(body)
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("%w %q", ErrUnsupportedEncoding, encoding)
+}
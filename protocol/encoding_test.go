@@ -0,0 +1,51 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat(`{"name":"cpu_usage","value":42}`, 100))
+
+	for _, encoding := range []string{"", EncodingGzip, EncodingZstd} {
+		compressed, err := Compress(data, encoding)
+		if err != nil {
+			t.Fatalf("Compress(%q): %v", encoding, err)
+		}
+		if encoding != "" && len(compressed) >= len(data) {
+			t.Errorf("Compress(%q) did not shrink %d bytes, got %d", encoding, len(data), len(compressed))
+		}
+
+		reader, err := Decompress(bytes.NewReader(compressed), encoding)
+		if err != nil {
+			t.Fatalf("Decompress(%q): %v", encoding, err)
+		}
+		decompressed, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("reading %q body: %v", encoding, err)
+		}
+
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("%q round trip changed the data", encoding)
+		}
+	}
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	if _, err := Compress([]byte("{}"), "br"); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Compress(br) = %v, want ErrUnsupportedEncoding", err)
+	}
+	if _, err := Decompress(strings.NewReader("{}"), "br"); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Decompress(br) = %v, want ErrUnsupportedEncoding", err)
+	}
+
+	// a corrupt body is not an unsupported encoding
+	if _, err := Decompress(strings.NewReader("not gzip"), EncodingGzip); err == nil || errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Decompress(corrupt gzip) = %v, want a decode error", err)
+	}
+}
@@ -0,0 +1,14 @@
+package protocol
+
+import "time"
+
+const AgentEventRestart = "restart"
+
+// something that happened to an agent, as recorded by the server
+type AgentEvent struct {
+	Type      string    `json:"type"`
+	AgentID   string    `json:"agent_id"`
+	Hostname  string    `json:"hostname"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+}
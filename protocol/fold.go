@@ -0,0 +1,660 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fold a single metric into the nested v1 view
+func (m *AgentMetrics) Add(metric Metric) {
+	newFolder(m).add(metric)
+}
+
+// folds metrics into a v1 view, indexing the lists that can grow large so
+// folding a whole payload stays linear
+type folder struct {
+	m       *AgentMetrics
+	cgroups map[string]int // position of each path in Metrics.Cgroups
+}
+
+func newFolder(m *AgentMetrics) *folder {
+	f := &folder{
+		m:       m,
+		cgroups: make(map[string]int, len(m.Metrics.Cgroups)),
+	}
+	for i, cgroup := range m.Metrics.Cgroups {
+		f.cgroups[cgroup.Path] = i
+	}
+
+	return f
+}
+
+func (f *folder) add(metric Metric) {
+	f.m.addCPU(metric)
+	f.m.addPressure(metric)
+	f.m.addMemory(metric)
+	f.m.addDisk(metric)
+	f.m.addNetwork(metric)
+	f.m.addProcess(metric)
+	f.addCgroup(metric)
+	f.m.addSensor(metric)
+	f.m.addSockets(metric)
+}
+
+func (m *AgentMetrics) addCPU(metric Metric) {
+	switch metric.Name {
+	case "cpu_usage", "cpu_mode_percent":
+		m.addCPUUsage(metric)
+	case "cpu_usage_moving_average", "cpu_usage_rate_of_change", "cpu_usage_sustained_high":
+		m.addCPUTrend(metric)
+	case "cpu_load_average_1m":
+		m.Metrics.CPU.Load.OneMin = metric.Value
+	case "cpu_load_average_5m":
+		m.Metrics.CPU.Load.FiveMin = metric.Value
+	case "cpu_load_average_15m":
+		m.Metrics.CPU.Load.FifteenMin = metric.Value
+	case "system_processes_total":
+		m.Metrics.CPU.Info.ProcessCount = int(metric.Value)
+	case "system_threads_total":
+		m.Metrics.CPU.Info.ThreadCount = int(metric.Value)
+	case "cpu_cores_logical":
+		m.Metrics.CPU.Info.LogicalCores = int(metric.Value)
+	case "cpu_cores_physical":
+		m.Metrics.CPU.Info.PhysicalCores = int(metric.Value)
+	case "cpu_context_switches_total":
+		m.Metrics.CPU.Stats.ContextSwitches = uint64(metric.Value)
+	case "cpu_context_switches_per_second":
+		m.Metrics.CPU.Stats.ContextSwitchesPerSecond = metric.Value
+	case "cpu_interrupts_total":
+		m.Metrics.CPU.Stats.Interrupts = uint64(metric.Value)
+	case "cpu_interrupts_per_second":
+		m.Metrics.CPU.Stats.InterruptsPerSecond = metric.Value
+	case "system_forks_total":
+		m.Metrics.CPU.Stats.Forks = uint64(metric.Value)
+	case "system_forks_per_second":
+		m.Metrics.CPU.Stats.ForksPerSecond = metric.Value
+	case "system_procs_running":
+		m.Metrics.CPU.Stats.ProcsRunning = int(metric.Value)
+	case "system_procs_blocked":
+		m.Metrics.CPU.Stats.ProcsBlocked = int(metric.Value)
+	}
+
+	// cpu times
+	if metric.Labels["cpu"] != "" && strings.HasPrefix(metric.Name, "cpu_time_") {
+		cpu := metric.Labels["cpu"]
+		if m.Metrics.CPU.Times == nil {
+			m.Metrics.CPU.Times = make(map[string]CPUTimes)
+		}
+		times := m.Metrics.CPU.Times[cpu]
+		switch metric.Name {
+		case "cpu_time_user":
+			times.User = metric.Value
+		case "cpu_time_system":
+			times.System = metric.Value
+		case "cpu_time_idle":
+			times.Idle = metric.Value
+		case "cpu_time_iowait":
+			times.IOWait = metric.Value
+		case "cpu_time_irq":
+			times.IRQ = metric.Value
+		}
+		m.Metrics.CPU.Times[cpu] = times
+	}
+}
+
+// usage and mode percentages, for the whole machine (cpu="total") or a core
+func (m *AgentMetrics) addCPUUsage(metric Metric) {
+	cpu := metric.Labels["cpu"]
+	mode := metric.Labels["mode"]
+
+	if cpu == "total" {
+		if metric.Name == "cpu_usage" {
+			m.Metrics.CPU.Usage = metric.Value
+			return
+		}
+		if m.Metrics.CPU.Modes == nil {
+			m.Metrics.CPU.Modes = make(map[string]float64)
+		}
+		m.Metrics.CPU.Modes[mode] = metric.Value
+		return
+	}
+
+	var coreNum int
+	if _, err := fmt.Sscanf(cpu, "cpu%d", &coreNum); err != nil {
+		return
+	}
+
+	index := -1
+	for i, core := range m.Metrics.CPU.Cores {
+		if core.Core == coreNum {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		m.Metrics.CPU.Cores = append(m.Metrics.CPU.Cores, CPUCore{
+			Core:  coreNum,
+			Modes: make(map[string]float64),
+		})
+		index = len(m.Metrics.CPU.Cores) - 1
+	}
+
+	core := &m.Metrics.CPU.Cores[index]
+	if metric.Name == "cpu_usage" {
+		core.Usage = metric.Value
+	} else {
+		core.Modes[mode] = metric.Value
+	}
+}
+
+func (m *AgentMetrics) addCPUTrend(metric Metric) {
+	cpu := metric.Labels["cpu"]
+	window := metric.Labels["window"]
+
+	if m.Metrics.CPU.Trends == nil {
+		m.Metrics.CPU.Trends = make(map[string]CPUTrend)
+	}
+
+	trend, exists := m.Metrics.CPU.Trends[cpu]
+	if !exists {
+		trend = CPUTrend{
+			MovingAverage: make(map[string]float64),
+			RateOfChange:  make(map[string]float64),
+		}
+	}
+
+	switch metric.Name {
+	case "cpu_usage_moving_average":
+		trend.MovingAverage[window] = metric.Value
+	case "cpu_usage_rate_of_change":
+		trend.RateOfChange[window] = metric.Value
+	case "cpu_usage_sustained_high":
+		trend.SustainedHigh = metric.Value > 0
+	}
+	m.Metrics.CPU.Trends[cpu] = trend
+}
+
+func (m *AgentMetrics) addPressure(metric Metric) {
+	if metric.Name == "pressure_supported" {
+		m.Metrics.Pressure.Supported = metric.Value > 0
+		return
+	}
+
+	var resource *PressureResource
+	switch metric.Labels["resource"] {
+	case "cpu":
+		resource = &m.Metrics.Pressure.CPU
+	case "memory":
+		resource = &m.Metrics.Pressure.Memory
+	case "io":
+		resource = &m.Metrics.Pressure.IO
+	default:
+		return
+	}
+
+	var stall *PressureStall
+	switch metric.Labels["kind"] {
+	case "some":
+		stall = &resource.Some
+	case "full":
+		stall = &resource.Full
+	default:
+		return
+	}
+
+	switch metric.Name {
+	case "pressure_avg10":
+		stall.Avg10 = metric.Value
+	case "pressure_avg60":
+		stall.Avg60 = metric.Value
+	case "pressure_avg300":
+		stall.Avg300 = metric.Value
+	case "pressure_stall_seconds_total":
+		stall.TotalSeconds = metric.Value
+	}
+}
+
+func (m *AgentMetrics) addMemory(metric Metric) {
+	switch metric.Labels["type"] {
+	case "virtual":
+		switch metric.Name {
+		case "memory_usage":
+			m.Metrics.Memory.Virtual.Usage = metric.Value
+		case "memory_total":
+			m.Metrics.Memory.Virtual.Total = uint64(metric.Value)
+		case "memory_used":
+			m.Metrics.Memory.Virtual.Used = uint64(metric.Value)
+		case "memory_free":
+			m.Metrics.Memory.Virtual.Free = uint64(metric.Value)
+		case "memory_cached":
+			m.Metrics.Memory.Virtual.Cached = uint64(metric.Value)
+		case "memory_available":
+			m.Metrics.Memory.Virtual.Available = uint64(metric.Value)
+		case "memory_committed_bytes":
+			m.Metrics.Memory.Virtual.Committed = uint64(metric.Value)
+		case "memory_commit_limit_bytes":
+			m.Metrics.Memory.Virtual.CommitLimit = uint64(metric.Value)
+		}
+	case "swap":
+		switch metric.Name {
+		case "memory_usage":
+			m.Metrics.Memory.Swap.Usage = metric.Value
+		case "memory_total":
+			m.Metrics.Memory.Swap.Total = uint64(metric.Value)
+		case "memory_used":
+			m.Metrics.Memory.Swap.Used = uint64(metric.Value)
+		case "swap_free":
+			m.Metrics.Memory.Swap.Free = uint64(metric.Value)
+		case "swap_in_bytes_total":
+			m.Metrics.Memory.Swap.SwapIn = uint64(metric.Value)
+		case "swap_out_bytes_total":
+			m.Metrics.Memory.Swap.SwapOut = uint64(metric.Value)
+		case "swap_in_bytes_per_second":
+			m.Metrics.Memory.Swap.SwapInPerSecond = metric.Value
+		case "swap_out_bytes_per_second":
+			m.Metrics.Memory.Swap.SwapOutPerSecond = metric.Value
+		}
+	case "paged":
+		switch metric.Name {
+		case "memory_page_tables":
+			m.Metrics.Memory.Paged.PageTables = uint64(metric.Value)
+		case "memory_mapped":
+			m.Metrics.Memory.Paged.Mapped = uint64(metric.Value)
+		case "memory_slab":
+			m.Metrics.Memory.Paged.Slab = uint64(metric.Value)
+		case "memory_page_cache":
+			m.Metrics.Memory.Paged.PageCache = uint64(metric.Value)
+		case "memory_writeback_temp":
+			m.Metrics.Memory.Paged.WritebackTemp = uint64(metric.Value)
+		case "memory_dirty_pages":
+			m.Metrics.Memory.Paged.Dirty = uint64(metric.Value)
+		case "memory_writeback_pages":
+			m.Metrics.Memory.Paged.Writeback = uint64(metric.Value)
+		}
+	case "hugepages":
+		switch metric.Name {
+		case "memory_hugepages_total":
+			m.Metrics.Memory.HugePages.Total = uint64(metric.Value)
+		case "memory_hugepages_free":
+			m.Metrics.Memory.HugePages.Free = uint64(metric.Value)
+		case "memory_hugepages_reserved":
+			m.Metrics.Memory.HugePages.Reserved = uint64(metric.Value)
+		case "memory_hugepages_surplus":
+			m.Metrics.Memory.HugePages.Surplus = uint64(metric.Value)
+		case "memory_hugepage_size_bytes":
+			m.Metrics.Memory.HugePages.PageSize = uint64(metric.Value)
+		}
+	case "vmstat":
+		switch metric.Name {
+		case "memory_page_faults_major_total":
+			m.Metrics.Memory.Paging.MajorFaults = uint64(metric.Value)
+		case "memory_page_faults_minor_total":
+			m.Metrics.Memory.Paging.MinorFaults = uint64(metric.Value)
+		case "memory_page_faults_major_per_second":
+			m.Metrics.Memory.Paging.MajorFaultsPerSecond = metric.Value
+		case "memory_page_faults_minor_per_second":
+			m.Metrics.Memory.Paging.MinorFaultsPerSecond = metric.Value
+		case "memory_pages_scanned_total":
+			m.Metrics.Memory.Paging.PagesScanned = uint64(metric.Value)
+		case "memory_pages_reclaimed_total":
+			m.Metrics.Memory.Paging.PagesReclaimed = uint64(metric.Value)
+		case "memory_pages_scanned_per_second":
+			m.Metrics.Memory.Paging.ScannedPerSecond = metric.Value
+		case "memory_pages_reclaimed_per_second":
+			m.Metrics.Memory.Paging.ReclaimedPerSecond = metric.Value
+		case "memory_oom_kills_total":
+			m.Metrics.Memory.Paging.OOMKills = uint64(metric.Value)
+		}
+	}
+}
+
+func (m *AgentMetrics) addDisk(metric Metric) {
+	if !strings.HasPrefix(metric.Name, "disk_") {
+		return
+	}
+
+	if mountpoint, ok := metric.Labels["mountpoint"]; ok {
+		m.addFilesystem(mountpoint, metric)
+		return
+	}
+
+	name, ok := metric.Labels["device"]
+	if !ok {
+		return
+	}
+
+	if m.Metrics.Disk == nil {
+		m.Metrics.Disk = make(map[string]DiskDevice)
+	}
+
+	device := m.Metrics.Disk[name]
+	switch metric.Name {
+	case "disk_reads_total":
+		device.ReadCount = uint64(metric.Value)
+	case "disk_writes_total":
+		device.WriteCount = uint64(metric.Value)
+	case "disk_read_bytes_total":
+		device.ReadBytes = uint64(metric.Value)
+	case "disk_write_bytes_total":
+		device.WriteBytes = uint64(metric.Value)
+	case "disk_read_speed_bytes_per_second":
+		device.ReadBytesPerSecond = metric.Value
+	case "disk_write_speed_bytes_per_second":
+		device.WriteBytesPerSecond = metric.Value
+	case "disk_read_iops":
+		device.ReadIOPS = metric.Value
+	case "disk_write_iops":
+		device.WriteIOPS = metric.Value
+	case "disk_total_iops":
+		device.TotalIOPS = metric.Value
+	case "disk_io_in_progress":
+		device.IOInProgress = uint64(metric.Value)
+	case "disk_read_await_milliseconds":
+		device.ReadAwaitMs = metric.Value
+	case "disk_write_await_milliseconds":
+		device.WriteAwaitMs = metric.Value
+	case "disk_utilization_percent":
+		device.Utilization = metric.Value
+	case "disk_queue_depth":
+		device.QueueDepth = metric.Value
+	default:
+		return
+	}
+	m.Metrics.Disk[name] = device
+}
+
+func (m *AgentMetrics) addNetwork(metric Metric) {
+	name, ok := metric.Labels["interface"]
+	if !ok {
+		return
+	}
+
+	if m.Metrics.Network == nil {
+		m.Metrics.Network = make(map[string]NetworkInterface)
+	}
+
+	iface := m.Metrics.Network[name]
+	switch metric.Name {
+	case "network_receive_bytes_total":
+		iface.BytesRecv = uint64(metric.Value)
+	case "network_transmit_bytes_total":
+		iface.BytesSent = uint64(metric.Value)
+	case "network_receive_packets_total":
+		iface.PacketsRecv = uint64(metric.Value)
+	case "network_transmit_packets_total":
+		iface.PacketsSent = uint64(metric.Value)
+	case "network_receive_errors_total":
+		iface.ErrorsIn = uint64(metric.Value)
+	case "network_transmit_errors_total":
+		iface.ErrorsOut = uint64(metric.Value)
+	case "network_receive_drops_total":
+		iface.DropsIn = uint64(metric.Value)
+	case "network_transmit_drops_total":
+		iface.DropsOut = uint64(metric.Value)
+	case "network_receive_bytes_per_second":
+		iface.RecvBytesPerSecond = metric.Value
+	case "network_transmit_bytes_per_second":
+		iface.SentBytesPerSecond = metric.Value
+	case "network_receive_packets_per_second":
+		iface.RecvPacketsPerSecond = metric.Value
+	case "network_transmit_packets_per_second":
+		iface.SentPacketsPerSecond = metric.Value
+	case "network_receive_errors_per_second":
+		iface.ErrorsInPerSecond = metric.Value
+	case "network_transmit_errors_per_second":
+		iface.ErrorsOutPerSecond = metric.Value
+	case "network_receive_drops_per_second":
+		iface.DropsInPerSecond = metric.Value
+	case "network_transmit_drops_per_second":
+		iface.DropsOutPerSecond = metric.Value
+	default:
+		return
+	}
+	m.Metrics.Network[name] = iface
+}
+
+func (m *AgentMetrics) addFilesystem(mountpoint string, metric Metric) {
+	var fs *Filesystem
+	for i := range m.Metrics.Filesystems {
+		if m.Metrics.Filesystems[i].Mountpoint == mountpoint {
+			fs = &m.Metrics.Filesystems[i]
+			break
+		}
+	}
+	if fs == nil {
+		m.Metrics.Filesystems = append(m.Metrics.Filesystems, Filesystem{
+			Mountpoint: mountpoint,
+			Device:     metric.Labels["device"],
+			Fstype:     metric.Labels["fstype"],
+		})
+		fs = &m.Metrics.Filesystems[len(m.Metrics.Filesystems)-1]
+	}
+
+	switch metric.Name {
+	case "disk_total":
+		fs.Total = uint64(metric.Value)
+	case "disk_used":
+		fs.Used = uint64(metric.Value)
+	case "disk_free":
+		fs.Free = uint64(metric.Value)
+	case "disk_usage":
+		fs.Usage = metric.Value
+	case "disk_inodes_total":
+		fs.InodesTotal = uint64(metric.Value)
+	case "disk_inodes_used":
+		fs.InodesUsed = uint64(metric.Value)
+	case "disk_inodes_free":
+		fs.InodesFree = uint64(metric.Value)
+	case "disk_inodes_usage":
+		fs.InodesUsage = metric.Value
+	}
+}
+
+func (m *AgentMetrics) addProcess(metric Metric) {
+	if !strings.HasPrefix(metric.Name, "process_") {
+		return
+	}
+
+	pid, err := strconv.Atoi(metric.Labels["pid"])
+	if err != nil {
+		return
+	}
+
+	var proc *Process
+	for i := range m.Metrics.Processes {
+		if m.Metrics.Processes[i].PID == int32(pid) {
+			proc = &m.Metrics.Processes[i]
+			break
+		}
+	}
+	if proc == nil {
+		m.Metrics.Processes = append(m.Metrics.Processes, Process{
+			PID:     int32(pid),
+			Name:    metric.Labels["name"],
+			User:    metric.Labels["user"],
+			Cmdline: metric.Labels["cmdline"],
+		})
+		proc = &m.Metrics.Processes[len(m.Metrics.Processes)-1]
+	}
+
+	switch metric.Name {
+	case "process_cpu_percent":
+		proc.CPUPercent = metric.Value
+	case "process_memory_rss_bytes":
+		proc.RSS = uint64(metric.Value)
+	case "process_open_fds":
+		proc.OpenFDs = int(metric.Value)
+	case "process_io_read_bytes_total":
+		proc.ReadBytes = uint64(metric.Value)
+	case "process_io_write_bytes_total":
+		proc.WriteBytes = uint64(metric.Value)
+	case "process_io_read_bytes_per_second":
+		proc.ReadBytesPerSecond = metric.Value
+	case "process_io_write_bytes_per_second":
+		proc.WriteBytesPerSecond = metric.Value
+	}
+}
+
+// hosts can have thousands of cgroups, so they are looked up by path
+func (f *folder) addCgroup(metric Metric) {
+	path, ok := metric.Labels["cgroup"]
+	if !ok || !strings.HasPrefix(metric.Name, "cgroup_") {
+		return
+	}
+
+	m := f.m
+	i, ok := f.cgroups[path]
+	if !ok {
+		m.Metrics.Cgroups = append(m.Metrics.Cgroups, Cgroup{
+			Path:        path,
+			ContainerID: metric.Labels["container_id"],
+		})
+		i = len(m.Metrics.Cgroups) - 1
+		f.cgroups[path] = i
+	}
+	cgroup := &m.Metrics.Cgroups[i]
+
+	switch metric.Name {
+	case "cgroup_cpu_usage_seconds_total":
+		cgroup.CPUUsageSeconds = metric.Value
+	case "cgroup_cpu_user_seconds_total":
+		cgroup.CPUUserSeconds = metric.Value
+	case "cgroup_cpu_system_seconds_total":
+		cgroup.CPUSystemSeconds = metric.Value
+	case "cgroup_cpu_usage_percent":
+		cgroup.CPUUsagePercent = metric.Value
+	case "cgroup_cpu_periods_total":
+		cgroup.CPUPeriods = uint64(metric.Value)
+	case "cgroup_cpu_throttled_periods_total":
+		cgroup.ThrottledPeriods = uint64(metric.Value)
+	case "cgroup_cpu_throttled_seconds_total":
+		cgroup.ThrottledSeconds = metric.Value
+	case "cgroup_memory_current_bytes":
+		cgroup.MemoryCurrent = uint64(metric.Value)
+	case "cgroup_memory_max_bytes":
+		cgroup.MemoryMax = uint64(metric.Value)
+	case "cgroup_memory_oom_events_total":
+		cgroup.OOMEvents = uint64(metric.Value)
+	case "cgroup_memory_oom_kills_total":
+		cgroup.OOMKills = uint64(metric.Value)
+	case "cgroup_io_read_bytes_total":
+		cgroup.IOReadBytes = uint64(metric.Value)
+	case "cgroup_io_write_bytes_total":
+		cgroup.IOWriteBytes = uint64(metric.Value)
+	case "cgroup_io_read_ops_total":
+		cgroup.IOReadOps = uint64(metric.Value)
+	case "cgroup_io_write_ops_total":
+		cgroup.IOWriteOps = uint64(metric.Value)
+	}
+}
+
+func (m *AgentMetrics) addSensor(metric Metric) {
+	var sensorType string
+	switch metric.Name {
+	case "sensor_temperature_celsius", "sensor_temperature_critical_celsius", "sensor_temperature_max_celsius":
+		sensorType = "temperature"
+	case "sensor_fan_rpm":
+		sensorType = "fan"
+	case "sensor_voltage_volts":
+		sensorType = "voltage"
+	default:
+		return
+	}
+
+	source, name := metric.Labels["source"], metric.Labels["sensor"]
+
+	var sensor *Sensor
+	for i := range m.Metrics.Sensors {
+		s := &m.Metrics.Sensors[i]
+		if s.Source == source && s.Sensor == name && s.Type == sensorType {
+			sensor = s
+			break
+		}
+	}
+	if sensor == nil {
+		m.Metrics.Sensors = append(m.Metrics.Sensors, Sensor{
+			Source: source,
+			Chip:   metric.Labels["chip"],
+			Sensor: name,
+			Type:   sensorType,
+		})
+		sensor = &m.Metrics.Sensors[len(m.Metrics.Sensors)-1]
+	}
+
+	switch metric.Name {
+	case "sensor_temperature_critical_celsius":
+		sensor.Critical = metric.Value
+	case "sensor_temperature_max_celsius":
+		sensor.Max = metric.Value
+	default:
+		sensor.Value = metric.Value
+	}
+}
+
+func (m *AgentMetrics) addSockets(metric Metric) {
+	sockets := &m.Metrics.Sockets
+
+	if strings.HasPrefix(metric.Name, "sockstat_") {
+		if sockets.Sockstat == nil {
+			sockets.Sockstat = make(map[string]float64)
+		}
+		sockets.Sockstat[strings.TrimPrefix(metric.Name, "sockstat_")] = metric.Value
+		return
+	}
+
+	switch metric.Name {
+	case "socket_tcp_connections":
+		if sockets.TCPStates == nil {
+			sockets.TCPStates = make(map[string]int)
+		}
+		sockets.TCPStates[metric.Labels["state"]] = int(metric.Value)
+	case "socket_udp_sockets":
+		sockets.UDPSockets = int(metric.Value)
+	case "socket_listening":
+		port, _ := strconv.Atoi(metric.Labels["port"])
+		sockets.Listening = append(sockets.Listening, ListeningSocket{
+			Protocol: metric.Labels["protocol"],
+			Address:  metric.Labels["address"],
+			Port:     port,
+		})
+	case "socket_tcp_active_opens_total":
+		sockets.TCP.ActiveOpens = uint64(metric.Value)
+	case "socket_tcp_passive_opens_total":
+		sockets.TCP.PassiveOpens = uint64(metric.Value)
+	case "socket_tcp_attempt_fails_total":
+		sockets.TCP.AttemptFails = uint64(metric.Value)
+	case "socket_tcp_established_resets_total":
+		sockets.TCP.EstablishedResets = uint64(metric.Value)
+	case "socket_tcp_current_established":
+		sockets.TCP.CurrentEstablished = uint64(metric.Value)
+	case "socket_tcp_segments_received_total":
+		sockets.TCP.SegmentsReceived = uint64(metric.Value)
+	case "socket_tcp_segments_sent_total":
+		sockets.TCP.SegmentsSent = uint64(metric.Value)
+	case "socket_tcp_segments_retransmitted_total":
+		sockets.TCP.SegmentsRetransmitted = uint64(metric.Value)
+	case "socket_tcp_receive_errors_total":
+		sockets.TCP.ReceiveErrors = uint64(metric.Value)
+	case "socket_tcp_resets_sent_total":
+		sockets.TCP.ResetsSent = uint64(metric.Value)
+	case "socket_tcp_segments_received_per_second":
+		sockets.TCP.SegmentsReceivedPerSecond = metric.Value
+	case "socket_tcp_segments_sent_per_second":
+		sockets.TCP.SegmentsSentPerSecond = metric.Value
+	case "socket_tcp_segments_retransmitted_per_second":
+		sockets.TCP.SegmentsRetransmittedPerSecond = metric.Value
+	case "socket_udp_datagrams_received_total":
+		sockets.UDP.DatagramsReceived = uint64(metric.Value)
+	case "socket_udp_datagrams_sent_total":
+		sockets.UDP.DatagramsSent = uint64(metric.Value)
+	case "socket_udp_no_port_total":
+		sockets.UDP.NoPort = uint64(metric.Value)
+	case "socket_udp_receive_errors_total":
+		sockets.UDP.ReceiveErrors = uint64(metric.Value)
+	case "socket_udp_receive_buffer_errors_total":
+		sockets.UDP.ReceiveBufferErrors = uint64(metric.Value)
+	case "socket_udp_send_buffer_errors_total":
+		sockets.UDP.SendBufferErrors = uint64(metric.Value)
+	}
+}
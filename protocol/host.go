@@ -0,0 +1,35 @@
+package protocol
+
+// facts discovered by the agent about the host it runs on
+type HostInfo struct {
+	OS                 string   `json:"os"`       // linux, darwin, windows, ...
+	Platform           string   `json:"platform"` // ubuntu, debian, ...
+	PlatformVersion    string   `json:"platform_version"`
+	Kernel             string   `json:"kernel"`
+	Arch               string   `json:"arch"`
+	Virtualization     string   `json:"virtualization,omitempty"` // kvm, docker, ...
+	VirtualizationRole string   `json:"virtualization_role,omitempty"`
+	IPs                []string `json:"ips"`
+}
+
+// labels used to select agents: the static labels, plus host facts under
+// their own names (os, platform, kernel, arch, virtualization) and the
+// hostname, unless a static label of the same name overrides them
+func SelectorLabels(hostname string, labels map[string]string, host *HostInfo) map[string]string {
+	selectable := make(map[string]string, len(labels)+6)
+
+	selectable["hostname"] = hostname
+	if host != nil {
+		selectable["os"] = host.OS
+		selectable["platform"] = host.Platform
+		selectable["kernel"] = host.Kernel
+		selectable["arch"] = host.Arch
+		selectable["virtualization"] = host.Virtualization
+	}
+
+	for key, value := range labels {
+		selectable[key] = value
+	}
+
+	return selectable
+}
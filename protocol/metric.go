@@ -0,0 +1,108 @@
+// Package protocol defines the payloads exchanged between agents and the
+// server.
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// version of the v2 metric list payload, bumped on incompatible changes
+const SchemaVersion = 2
+
+const (
+	MetricTypeGauge   = "gauge"
+	MetricTypeCounter = "counter"
+)
+
+// a single labeled sample
+type Metric struct {
+	Name      string            `json:"name"`
+	Value     float64           `json:"value"`
+	Timestamp time.Time         `json:"timestamp"`
+	Labels    map[string]string `json:"labels"`
+	Type      string            `json:"type,omitempty"` // gauge or counter
+	Unit      string            `json:"unit,omitempty"`
+}
+
+// v2 payload, the flat list of metrics collected by an agent
+type MetricsPayload struct {
+	SchemaVersion int               `json:"schema_version"`
+	AgentID       string            `json:"agent_id"`
+	Hostname      string            `json:"hostname"`
+	Timestamp     time.Time         `json:"timestamp"`
+	StartedAt     time.Time         `json:"started_at"`       // agent process start, changes on restart
+	Labels        map[string]string `json:"labels,omitempty"` // static agent labels
+	Host          *HostInfo         `json:"host,omitempty"`
+	Metrics       []Metric          `json:"metrics"`
+	Errors        []CollectorError  `json:"errors,omitempty"` // collectors that failed
+	Stale         []string          `json:"stale,omitempty"`  // collectors whose metrics are repeated from an earlier payload
+}
+
+// a collector whose last run failed or timed out, its metrics are missing
+// from the payload
+type CollectorError struct {
+	Collector string    `json:"collector"`
+	Message   string    `json:"message"`
+	Duration  float64   `json:"duration_seconds"` // until it failed or timed out
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// create an empty payload for the current schema version
+func NewMetricsPayload(agentID, hostname string, timestamp time.Time) MetricsPayload {
+	return MetricsPayload{
+		SchemaVersion: SchemaVersion,
+		AgentID:       agentID,
+		Hostname:      hostname,
+		Timestamp:     timestamp,
+		Metrics:       []Metric{},
+	}
+}
+
+func (m Metric) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("missing metric name")
+	}
+
+	if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+		return fmt.Errorf("metric %s: invalid value %v", m.Name, m.Value)
+	}
+
+	switch m.Type {
+	case "", MetricTypeGauge, MetricTypeCounter:
+	default:
+		return fmt.Errorf("metric %s: unknown type %q", m.Name, m.Type)
+	}
+
+	return nil
+}
+
+func (p MetricsPayload) Validate() error {
+	// agents predating schema_version leave it out, their payloads are v2
+	if p.SchemaVersion != 0 && p.SchemaVersion != SchemaVersion {
+		return fmt.Errorf("unsupported schema version %d", p.SchemaVersion)
+	}
+
+	if p.AgentID == "" {
+		return fmt.Errorf("missing agent_id")
+	}
+
+	if p.Timestamp.IsZero() {
+		return fmt.Errorf("missing timestamp")
+	}
+
+	for i, metric := range p.Metrics {
+		if err := metric.Validate(); err != nil {
+			return fmt.Errorf("metrics[%d]: %v", i, err)
+		}
+	}
+
+	for i, collectorErr := range p.Errors {
+		if collectorErr.Collector == "" {
+			return fmt.Errorf("errors[%d]: missing collector name", i)
+		}
+	}
+
+	return nil
+}
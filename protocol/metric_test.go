@@ -0,0 +1,125 @@
+package protocol
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPayload() MetricsPayload {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	payload := NewMetricsPayload("agent-1", "web-1", now)
+	payload.StartedAt = now.Add(-time.Hour)
+	payload.Labels = map[string]string{"env": "dev"}
+	payload.Host = &HostInfo{OS: "linux", Arch: "amd64"}
+	payload.Metrics = []Metric{
+		{Name: "cpu_usage", Value: 42.5, Timestamp: now, Labels: map[string]string{"cpu": "total"}, Type: MetricTypeGauge, Unit: "percent"},
+		{Name: "memory_total", Value: 8 << 30, Timestamp: now, Labels: map[string]string{"type": "virtual"}, Unit: "bytes"},
+	}
+	payload.Errors = []CollectorError{
+		{Collector: "sensors", Message: "timed out after 10s", Duration: 10, Timestamp: now},
+	}
+
+	return payload
+}
+
+func TestMetricsPayloadRoundTrip(t *testing.T) {
+	payload := testPayload()
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var decoded MetricsPayload
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, payload) {
+		t.Errorf("round trip changed the payload:\n got %+v\nwant %+v", decoded, payload)
+	}
+
+	if !strings.Contains(string(data), `"schema_version":2`) {
+		t.Errorf("encoded payload lacks schema_version 2: %s", data)
+	}
+}
+
+func TestMetricsPayloadValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*MetricsPayload)
+		err    string
+	}{
+		{name: "valid", modify: func(p *MetricsPayload) {}},
+		{name: "no schema version", modify: func(p *MetricsPayload) { p.SchemaVersion = 0 }},
+		{name: "no metrics", modify: func(p *MetricsPayload) { p.Metrics = nil }},
+		{
+			name:   "future schema version",
+			modify: func(p *MetricsPayload) { p.SchemaVersion = 3 },
+			err:    "unsupported schema version 3",
+		},
+		{
+			name:   "legacy schema version",
+			modify: func(p *MetricsPayload) { p.SchemaVersion = LegacySchemaVersion },
+			err:    "unsupported schema version",
+		},
+		{
+			name:   "missing agent id",
+			modify: func(p *MetricsPayload) { p.AgentID = "" },
+			err:    "missing agent_id",
+		},
+		{
+			name:   "missing timestamp",
+			modify: func(p *MetricsPayload) { p.Timestamp = time.Time{} },
+			err:    "missing timestamp",
+		},
+		{
+			name:   "unnamed metric",
+			modify: func(p *MetricsPayload) { p.Metrics[1].Name = "" },
+			err:    "metrics[1]: missing metric name",
+		},
+		{
+			name:   "nan value",
+			modify: func(p *MetricsPayload) { p.Metrics[0].Value = math.NaN() },
+			err:    "metrics[0]: metric cpu_usage: invalid value",
+		},
+		{
+			name:   "infinite value",
+			modify: func(p *MetricsPayload) { p.Metrics[0].Value = math.Inf(1) },
+			err:    "invalid value",
+		},
+		{
+			name:   "unknown type",
+			modify: func(p *MetricsPayload) { p.Metrics[0].Type = "histogram" },
+			err:    `unknown type "histogram"`,
+		},
+		{
+			name:   "unnamed collector error",
+			modify: func(p *MetricsPayload) { p.Errors[0].Collector = "" },
+			err:    "errors[0]: missing collector name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := testPayload()
+			tt.modify(&payload)
+
+			err := payload.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Validate() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
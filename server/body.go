@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"ddgo/protocol"
+)
+
+// largest accepted request body after decompression
+const maxBodyBytes = 64 << 20
+
+// error from reading a request body, with the status to reply with
+type bodyError struct {
+	status int
+	err    error
+}
+
+func (e *bodyError) Error() string {
+	return e.err.Error()
+}
+
+// request body, decompressed according to its Content-Encoding. unknown
+// encodings are a 415, bodies that are not valid for theirs a 400
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	reader, err := protocol.Decompress(r.Body, r.Header.Get("Content-Encoding"))
+	if errors.Is(err, protocol.ErrUnsupportedEncoding) {
+		return nil, &bodyError{http.StatusUnsupportedMediaType, err}
+	}
+	if err != nil {
+		return nil, &bodyError{http.StatusBadRequest, fmt.Errorf("error decoding body: %v", err)}
+	}
+	defer reader.Close()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, reader, maxBodyBytes))
+	if err != nil {
+		return nil, &bodyError{http.StatusBadRequest, fmt.Errorf("error reading body: %v", err)}
+	}
+
+	return body, nil
+}
+
+// a single item, or a batch of them as a json array
+func decodeItems[T any](body []byte) ([]T, error) {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []T
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+
+	var item T
+	if err := json.Unmarshal(body, &item); err != nil {
+		return nil, err
+	}
+	return []T{item}, nil
+}
+
+// read and decode a payload or batch of payloads, replying with an error
+// status and returning false if that fails
+func readItems[T interface{ Validate() error }](w http.ResponseWriter, r *http.Request) ([]T, bool) {
+	body, err := readBody(w, r)
+	if err != nil {
+		status := http.StatusBadRequest
+		if bodyErr, ok := err.(*bodyError); ok {
+			status = bodyErr.status
+		}
+		http.Error(w, fmt.Sprintf("Invalid metrics data: %v", err), status)
+		return nil, false
+	}
+
+	items, err := decodeItems[T](body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid metrics data: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	for i, item := range items {
+		if err := item.Validate(); err != nil {
+			if len(items) > 1 {
+				err = fmt.Errorf("item %d: %v", i, err)
+			}
+			http.Error(w, fmt.Sprintf("Invalid metrics data: %v", err), http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	return items, true
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ddgo/protocol"
+)
+
+func testPayload(agentID string) protocol.MetricsPayload {
+	now := time.Now()
+
+	payload := protocol.NewMetricsPayload(agentID, agentID+".local", now)
+	payload.StartedAt = now.Add(-time.Minute)
+	payload.Metrics = []protocol.Metric{
+		{Name: "cpu_usage", Value: 12.5, Timestamp: now, Labels: map[string]string{"cpu": "total"}},
+	}
+
+	return payload
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func mustCompress(t *testing.T, data []byte, encoding string) []byte {
+	t.Helper()
+
+	compressed, err := protocol.Compress(data, encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compressed
+}
+
+// post body to handler and return the recorded response
+func post(handler http.HandlerFunc, body []byte, encoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/metrics/collect", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestCollectAgentsV2Batch(t *testing.T) {
+	s := StartServer()
+
+	batch := []protocol.MetricsPayload{testPayload("agent-1"), testPayload("agent-2")}
+	if rec := post(s.CollectAgentsV2, mustMarshal(t, batch), ""); rec.Code != http.StatusOK {
+		t.Fatalf("batch: status %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := post(s.CollectAgentsV2, mustMarshal(t, testPayload("agent-3")), ""); rec.Code != http.StatusOK {
+		t.Fatalf("single payload: status %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, id := range []string{"agent-1", "agent-2", "agent-3"} {
+		if _, ok := s.series[id]; !ok {
+			t.Errorf("no v2 metrics stored for %s", id)
+		}
+		if legacy, ok := s.agents[id]; !ok || legacy.Metrics.CPU.Usage != 12.5 {
+			t.Errorf("v1 view of %s = %+v, want cpu usage 12.5", id, legacy.Metrics.CPU)
+		}
+	}
+}
+
+func TestCollectAgentsBatch(t *testing.T) {
+	s := StartServer()
+
+	batch := []protocol.AgentMetrics{
+		{SchemaVersion: protocol.LegacySchemaVersion, AgentID: "agent-1", Timestamp: time.Now()},
+		{AgentID: "agent-2", Timestamp: time.Now()},
+	}
+	if rec := post(s.CollectAgents, mustMarshal(t, batch), ""); rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	if len(s.agents) != 2 {
+		t.Errorf("stored %d agents, want 2", len(s.agents))
+	}
+}
+
+func TestCollectAgentsV2Encodings(t *testing.T) {
+	for _, encoding := range []string{"", "identity", protocol.EncodingGzip, protocol.EncodingZstd} {
+		s := StartServer()
+
+		batch := []protocol.MetricsPayload{testPayload("agent-1"), testPayload("agent-2")}
+		body := mustMarshal(t, batch)
+		if encoding != "identity" {
+			body = mustCompress(t, body, encoding)
+		}
+
+		if rec := post(s.CollectAgentsV2, body, encoding); rec.Code != http.StatusOK {
+			t.Errorf("%q: status %d: %s", encoding, rec.Code, rec.Body)
+			continue
+		}
+		if len(s.series) != 2 {
+			t.Errorf("%q: stored %d agents, want 2", encoding, len(s.series))
+		}
+	}
+}
+
+func TestCollectAgentsV2ErrorStatus(t *testing.T) {
+	valid := mustMarshal(t, testPayload("agent-1"))
+	invalid := testPayload("")
+
+	tests := []struct {
+		name     string
+		body     []byte
+		encoding string
+		status   int
+	}{
+		{name: "unknown encoding", body: valid, encoding: "br", status: http.StatusUnsupportedMediaType},
+		{name: "corrupt gzip", body: []byte("not gzip at all"), encoding: protocol.EncodingGzip, status: http.StatusBadRequest},
+		{name: "corrupt zstd", body: []byte("not zstd at all"), encoding: protocol.EncodingZstd, status: http.StatusBadRequest},
+		{name: "truncated gzip", body: mustCompress(t, valid, protocol.EncodingGzip)[:20], encoding: protocol.EncodingGzip, status: http.StatusBadRequest},
+		{name: "invalid json", body: []byte(`{"agent_id":`), status: http.StatusBadRequest},
+		{name: "invalid payload", body: mustMarshal(t, invalid), status: http.StatusBadRequest},
+		{
+			name:   "invalid payload in batch",
+			body:   mustMarshal(t, []protocol.MetricsPayload{testPayload("agent-1"), invalid}),
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := StartServer()
+
+			rec := post(s.CollectAgentsV2, tt.body, tt.encoding)
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if len(s.series) != 0 {
+				t.Errorf("stored %d agents from a rejected request", len(s.series))
+			}
+		})
+	}
+}
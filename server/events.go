@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"ddgo/protocol"
+)
+
+// number of agent events kept, oldest dropped first
+const maxEvents = 1000
+
+// notice agents that restarted since their last payload, s.mu must be held
+func (s *MetricsServer) trackStart(payload protocol.MetricsPayload) {
+	if payload.StartedAt.IsZero() {
+		return
+	}
+
+	last, seen := s.starts[payload.AgentID]
+	s.starts[payload.AgentID] = payload.StartedAt
+	if !seen || payload.StartedAt.Equal(last) {
+		return
+	}
+
+	message := fmt.Sprintf("agent restarted at %s (previous start %s)",
+		payload.StartedAt.Format(time.RFC3339), last.Format(time.RFC3339))
+	s.recordEvent(protocol.AgentEvent{
+		Type:      protocol.AgentEventRestart,
+		AgentID:   payload.AgentID,
+		Hostname:  payload.Hostname,
+		Timestamp: payload.Timestamp,
+		Message:   message,
+	})
+
+	log.Printf("Agent %s (%s) restarted", payload.AgentID, payload.Hostname)
+}
+
+// s.mu must be held
+func (s *MetricsServer) recordEvent(event protocol.AgentEvent) {
+	s.events = append(s.events, event)
+	if len(s.events) > maxEvents {
+		s.events = append([]protocol.AgentEvent(nil), s.events[len(s.events)-maxEvents:]...)
+	}
+}
+
+// returns recorded agent events, oldest first, optionally filtered with
+// ?agent_id=<id>
+func (s *MetricsServer) GetEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	agentID := r.URL.Query().Get("agent_id")
+
+	s.mu.RLock()
+	response := []protocol.AgentEvent{}
+	for _, event := range s.events {
+		if agentID == "" || event.AgentID == agentID {
+			response = append(response, event)
+		}
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
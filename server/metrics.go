@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"ddgo/protocol"
+)
+
+// collects v2 metric lists from agents, one payload or a json array of
+// them, optionally gzip or zstd compressed
+func (s *MetricsServer) CollectAgentsV2(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	batch, ok := readItems[protocol.MetricsPayload](w, r)
+	if !ok {
+		return
+	}
+
+	// payloads of a batch are in the order they were collected
+	received := time.Now()
+	for _, payload := range batch {
+		// keep the v1 view up to date for /api/metrics consumers
+		legacy := protocol.NewAgentMetrics(payload)
+
+		s.mu.Lock()
+		s.trackStart(payload)
+		s.series[payload.AgentID] = payload
+		s.agents[payload.AgentID] = legacy
+		s.seen[payload.AgentID] = received
+		s.mu.Unlock()
+
+		log.Printf("Received %d metrics from agent %s (%s)", len(payload.Metrics), payload.AgentID, payload.Hostname)
+		for _, collectorErr := range payload.Errors {
+			log.Printf("Agent %s (%s) %s collector failed: %s", payload.AgentID, payload.Hostname,
+				collectorErr.Collector, collectorErr.Message)
+		}
+	}
+}
+
+// returns the metric lists of all v2 agents, optionally filtered with
+//
+//	?agent_id=<id>&selector=<key>=<value>,...&name=<glob>&label=<key>=<value>
+//
+// where selector picks agents as in GetMetrics, and label may be repeated
+// with all metric labels having to match
+func (s *MetricsServer) GetMetricsV2(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	agentID := query.Get("agent_id")
+	name := query.Get("name")
+
+	labels := make(map[string]string)
+	for _, selector := range query["label"] {
+		key, value, ok := strings.Cut(selector, "=")
+		if !ok || key == "" {
+			http.Error(w, fmt.Sprintf("Invalid label selector %q", selector), http.StatusBadRequest)
+			return
+		}
+		labels[key] = value
+	}
+
+	sel, err := parseSelector(query.Get("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := path.Match(name, ""); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid name pattern %q", name), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	response := make(map[string]protocol.MetricsPayload)
+	for id, payload := range s.series {
+		if agentID != "" && id != agentID {
+			continue
+		}
+		if !sel.matches(payload.Hostname, payload.Labels, payload.Host) {
+			continue
+		}
+
+		filtered := payload
+		filtered.Metrics = []protocol.Metric{}
+		for _, metric := range payload.Metrics {
+			if metricMatches(metric, name, labels) {
+				filtered.Metrics = append(filtered.Metrics, metric)
+			}
+		}
+		response[id] = filtered
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// whether the metric matches the name glob (empty matches all) and carries
+// all of the given labels
+func metricMatches(m protocol.Metric, name string, labels map[string]string) bool {
+	if name != "" {
+		if matched, _ := path.Match(name, m.Name); !matched {
+			return false
+		}
+	}
+
+	for key, value := range labels {
+		if m.Labels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
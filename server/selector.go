@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"ddgo/protocol"
+)
+
+// one term of a label selector, key=value or key!=value
+type requirement struct {
+	key    string
+	value  string
+	negate bool
+}
+
+// comma-separated requirements that must all hold, e.g.
+//
+//	env=prod,role!=db,arch=x86_64
+//
+// keys are static agent labels, the host facts listed in
+// protocol.SelectorLabels, or ip (any address of the host)
+type selector []requirement
+
+func parseSelector(raw string) (selector, error) {
+	sel := selector{}
+	for _, term := range strings.Split(raw, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		req := requirement{}
+		key, value, ok := strings.Cut(term, "!=")
+		if ok {
+			req.negate = true
+		} else if key, value, ok = strings.Cut(term, "="); !ok {
+			return nil, fmt.Errorf("invalid selector term %q, expected key=value or key!=value", term)
+		}
+
+		req.key = strings.TrimSpace(key)
+		req.value = strings.TrimSpace(value)
+		if req.key == "" {
+			return nil, fmt.Errorf("invalid selector term %q, missing key", term)
+		}
+
+		sel = append(sel, req)
+	}
+
+	return sel, nil
+}
+
+func (sel selector) matches(hostname string, labels map[string]string, host *protocol.HostInfo) bool {
+	if len(sel) == 0 {
+		return true
+	}
+
+	selectable := protocol.SelectorLabels(hostname, labels, host)
+	for _, req := range sel {
+		var matched bool
+		if req.key == "ip" && host != nil {
+			for _, ip := range host.IPs {
+				if ip == req.value {
+					matched = true
+					break
+				}
+			}
+		} else {
+			matched = selectable[req.key] == req.value
+		}
+
+		if matched == req.negate {
+			return false
+		}
+	}
+
+	return true
+}